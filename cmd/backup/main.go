@@ -0,0 +1,203 @@
+package main
+
+import (
+	"archive/tar"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"cloud.google.com/go/firestore"
+	"cloud.google.com/go/storage"
+	"github.com/sugyan/image-dataset/web/backup"
+	"google.golang.org/api/iterator"
+)
+
+var (
+	projectID  string
+	outdir     string
+	skipImages bool
+)
+
+func init() {
+	flag.StringVar(&projectID, "projectID", "", "project ID")
+	flag.StringVar(&outdir, "outdir", "backup", "path to output directory")
+	flag.BoolVar(&skipImages, "skip_images", false, "back up documents only")
+}
+
+func main() {
+	flag.Parse()
+	if projectID == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+	if err := run(context.Background()); err != nil {
+		log.Fatal(err)
+	}
+	log.Println("finish")
+}
+
+func run(ctx context.Context) error {
+	fsClient, err := firestore.NewClient(ctx, projectID)
+	if err != nil {
+		return err
+	}
+	defer fsClient.Close()
+	if err := os.MkdirAll(outdir, 0755); err != nil {
+		return err
+	}
+
+	checksums := map[string]string{}
+	for _, kind := range backup.Kinds {
+		filename := kind + backup.DocumentsExt
+		// subcollections are collected from all parents
+		query := fsClient.CollectionGroup(kind).Query
+		n := 0
+		checksum, err := writeFile(filepath.Join(outdir, filename), func(w io.Writer) error {
+			var err error
+			n, err = writeDocuments(ctx, w, kind, query)
+			return err
+		})
+		if err != nil {
+			return err
+		}
+		checksums[filename] = checksum
+		log.Printf("%s: %d documents", kind, n)
+	}
+	if !skipImages {
+		csClient, err := storage.NewClient(ctx)
+		if err != nil {
+			return err
+		}
+		defer csClient.Close()
+		bucketName := projectID + ".appspot.com"
+		if os.Getenv("DEVELOPMENT") != "" {
+			bucketName = "staging." + bucketName
+		}
+		n := 0
+		checksum, err := writeFile(filepath.Join(outdir, backup.ImagesFile), func(w io.Writer) error {
+			var err error
+			n, err = writeImages(ctx, w, csClient.Bucket(bucketName))
+			return err
+		})
+		if err != nil {
+			return err
+		}
+		checksums[backup.ImagesFile] = checksum
+		log.Printf("images: %d objects", n)
+	}
+
+	// in the format of `sha256sum`, to be verified with `sha256sum -c`
+	filenames := []string{}
+	for filename := range checksums {
+		filenames = append(filenames, filename)
+	}
+	sort.Strings(filenames)
+	lines := []string{}
+	for _, filename := range filenames {
+		lines = append(lines, fmt.Sprintf("%s  %s\n", checksums[filename], filename))
+	}
+	return ioutil.WriteFile(filepath.Join(outdir, backup.ChecksumsFile), []byte(strings.Join(lines, "")), 0644)
+}
+
+// writeFile writes a file with write function and returns its SHA-256 checksum
+func writeFile(path string, write func(io.Writer) error) (string, error) {
+	file, err := os.Create(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+	hash := sha256.New()
+	if err := write(io.MultiWriter(file, hash)); err != nil {
+		return "", err
+	}
+	if err := file.Close(); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+func writeDocuments(ctx context.Context, w io.Writer, kind string, query firestore.Query) (int, error) {
+	encoder := json.NewEncoder(w)
+	n := 0
+	iter := query.Documents(ctx)
+	for {
+		document, err := iter.Next()
+		if err != nil {
+			if errors.Is(err, iterator.Done) {
+				break
+			} else {
+				return n, err
+			}
+		}
+		// documents are written as the entity types not to lose the types of values
+		e, err := backup.NewEntity(kind)
+		if err != nil {
+			return n, err
+		}
+		if err := document.DataTo(e); err != nil {
+			return n, fmt.Errorf("%s: %w", document.Ref.Path, err)
+		}
+		data, err := json.Marshal(e)
+		if err != nil {
+			return n, err
+		}
+		path := document.Ref.Path
+		if i := strings.Index(path, "/documents/"); i >= 0 {
+			path = path[i+len("/documents/"):]
+		}
+		if err := encoder.Encode(&backup.Record{Path: path, Data: data}); err != nil {
+			return n, err
+		}
+		n++
+	}
+	return n, nil
+}
+
+func writeImages(ctx context.Context, w io.Writer, bucket *storage.BucketHandle) (int, error) {
+	tw := tar.NewWriter(w)
+	n := 0
+	iter := bucket.Objects(ctx, &storage.Query{Prefix: "images/"})
+	for {
+		attrs, err := iter.Next()
+		if err != nil {
+			if errors.Is(err, iterator.Done) {
+				break
+			} else {
+				return n, err
+			}
+		}
+		if err := tw.WriteHeader(&tar.Header{
+			Name:    attrs.Name,
+			Mode:    0644,
+			Size:    attrs.Size,
+			ModTime: attrs.Updated,
+		}); err != nil {
+			return n, err
+		}
+		r, err := bucket.Object(attrs.Name).NewReader(ctx)
+		if err != nil {
+			return n, err
+		}
+		_, err = io.Copy(tw, r)
+		r.Close()
+		if err != nil {
+			return n, err
+		}
+		n++
+		if n%1000 == 0 {
+			log.Printf("%d...", n)
+		}
+	}
+	return n, tw.Close()
+}
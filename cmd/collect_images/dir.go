@@ -0,0 +1,51 @@
+package main
+
+import (
+	"context"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// dirSource collects photos in a local directory, labeled by their parent directory
+type dirSource struct {
+	root  string
+	label string
+}
+
+func (s *dirSource) Collect(ctx context.Context, emit func(*Record) error) error {
+	return filepath.Walk(s.root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if info.IsDir() {
+			return nil
+		}
+		switch strings.ToLower(filepath.Ext(path)) {
+		case ".jpg", ".jpeg", ".png":
+		default:
+			return nil
+		}
+		abs, err := filepath.Abs(path)
+		if err != nil {
+			return err
+		}
+		u := (&url.URL{Scheme: "file", Path: filepath.ToSlash(abs)}).String()
+		label := s.label
+		if label == "" {
+			label = filepath.Base(filepath.Dir(abs))
+		}
+		return emit(&Record{
+			MediaID:     mediaID(u),
+			PhotoURL:    u,
+			SourceURL:   u,
+			PublishedAt: info.ModTime(),
+			Label:       label,
+			MediaType:   mediaTypePhoto,
+		})
+	})
+}
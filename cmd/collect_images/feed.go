@@ -0,0 +1,186 @@
+package main
+
+import (
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+)
+
+// feedSource collects photos of media enclosures in an RSS or Atom feed
+type feedSource struct {
+	url   string
+	label string
+}
+
+type feedMedia struct {
+	URL    string `xml:"url,attr"`
+	Type   string `xml:"type,attr"`
+	Medium string `xml:"medium,attr"`
+}
+
+type rssFeed struct {
+	Title string `xml:"channel>title"`
+	Items []struct {
+		Link      string      `xml:"link"`
+		GUID      string      `xml:"guid"`
+		PubDate   string      `xml:"pubDate"`
+		Author    string      `xml:"author"`
+		Enclosure []feedMedia `xml:"enclosure"`
+		Media     []feedMedia `xml:"http://search.yahoo.com/mrss/ content"`
+		Group     []feedMedia `xml:"http://search.yahoo.com/mrss/ group>content"`
+	} `xml:"channel>item"`
+}
+
+type atomFeed struct {
+	Title   string `xml:"title"`
+	Entries []struct {
+		ID        string `xml:"id"`
+		Published string `xml:"published"`
+		Updated   string `xml:"updated"`
+		Author    string `xml:"author>name"`
+		Links     []struct {
+			Rel  string `xml:"rel,attr"`
+			Href string `xml:"href,attr"`
+			Type string `xml:"type,attr"`
+		} `xml:"link"`
+		Media []feedMedia `xml:"http://search.yahoo.com/mrss/ content"`
+	} `xml:"entry"`
+}
+
+func (s *feedSource) Collect(ctx context.Context, emit func(*Record) error) error {
+	req, err := http.NewRequest(http.MethodGet, s.url, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := http.DefaultClient.Do(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return errors.New(resp.Status)
+	}
+	records, err := parseFeed(resp.Body, s.label)
+	if err != nil {
+		return fmt.Errorf("%s: %w", s.url, err)
+	}
+	for _, r := range records {
+		if err := emit(r); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// parseFeed returns records of image enclosures of the RSS or Atom feed.
+// Without label, the title of the feed is used.
+func parseFeed(r io.Reader, label string) ([]*Record, error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	var root struct {
+		XMLName xml.Name
+	}
+	if err := xml.Unmarshal(data, &root); err != nil {
+		return nil, err
+	}
+	records := []*Record{}
+	add := func(photoURL, sourceURL, published, author, title string) {
+		if label == "" {
+			label = strings.TrimSpace(title)
+		}
+		records = append(records, &Record{
+			MediaID:     mediaID(photoURL),
+			PhotoURL:    photoURL,
+			SourceURL:   sourceURL,
+			PublishedAt: parseFeedTime(published),
+			AuthorID:    strings.TrimSpace(author),
+			Label:       label,
+			MediaType:   mediaTypePhoto,
+		})
+	}
+	switch root.XMLName.Local {
+	case "rss":
+		var feed rssFeed
+		if err := xml.Unmarshal(data, &feed); err != nil {
+			return nil, err
+		}
+		for _, item := range feed.Items {
+			sourceURL := item.Link
+			if sourceURL == "" {
+				sourceURL = item.GUID
+			}
+			media := append(append(item.Enclosure, item.Media...), item.Group...)
+			for _, m := range media {
+				if isImage(m.URL, m.Type, m.Medium) {
+					add(m.URL, sourceURL, item.PubDate, item.Author, feed.Title)
+				}
+			}
+		}
+	case "feed":
+		var feed atomFeed
+		if err := xml.Unmarshal(data, &feed); err != nil {
+			return nil, err
+		}
+		for _, entry := range feed.Entries {
+			published := entry.Published
+			if published == "" {
+				published = entry.Updated
+			}
+			sourceURL := entry.ID
+			media := entry.Media
+			for _, link := range entry.Links {
+				switch link.Rel {
+				case "", "alternate":
+					sourceURL = link.Href
+				case "enclosure":
+					media = append(media, feedMedia{URL: link.Href, Type: link.Type})
+				}
+			}
+			for _, m := range media {
+				if isImage(m.URL, m.Type, m.Medium) {
+					add(m.URL, sourceURL, published, entry.Author, feed.Title)
+				}
+			}
+		}
+	default:
+		return nil, fmt.Errorf("unknown feed format: %s", root.XMLName.Local)
+	}
+	return records, nil
+}
+
+func isImage(u, mimeType, medium string) bool {
+	if u == "" {
+		return false
+	}
+	if mimeType != "" {
+		return strings.HasPrefix(mimeType, "image/")
+	}
+	if medium != "" {
+		return medium == "image"
+	}
+	switch strings.ToLower(path.Ext(mediaPath(u))) {
+	case ".jpg", ".jpeg", ".png":
+		return true
+	}
+	return false
+}
+
+// parseFeedTime returns the zero time if value is not a known format
+func parseFeedTime(value string) time.Time {
+	value = strings.TrimSpace(value)
+	for _, layout := range []string{time.RFC3339, time.RFC1123Z, time.RFC1123, time.RFC822Z, time.RFC822} {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t
+		}
+	}
+	return time.Time{}
+}
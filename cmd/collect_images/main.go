@@ -0,0 +1,82 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+)
+
+func main() {
+	sourceName := flag.String("source", "twitter", "source of images (twitter, dir, urls, feed)")
+	screenName := flag.String("screen_name", "", "target screen_name (twitter)")
+	targets := flag.String("targets", "", "file of target screen_names, one per line (twitter)")
+	statePath := flag.String("state", "", "file to keep the last collected tweet of each account (twitter)")
+	dir := flag.String("dir", "", "directory of photos (dir)")
+	urls := flag.String("urls", "", "file of photo URLs, - for stdin (urls)")
+	feedURL := flag.String("feed", "", "URL of RSS or Atom feed (feed)")
+	mediaTypes := flag.String("media_types", mediaTypePhoto, "comma-separated media types to collect, thumbnails of animated_gif and video are flagged by media_type in jsonl (twitter)")
+	format := flag.String("format", formatTSV, "output format (tsv, jsonl)")
+	label := flag.String("label", "", "label of collected photos (default: screen_name, directory name or feed title)")
+	flag.Parse()
+
+	var src Source
+	switch *sourceName {
+	case "twitter":
+		screenNames := []string{}
+		if *screenName != "" {
+			screenNames = append(screenNames, *screenName)
+		}
+		if *targets != "" {
+			names, err := readTargets(*targets)
+			if err != nil {
+				log.Fatal(err)
+			}
+			screenNames = append(screenNames, names...)
+		}
+		if len(screenNames) > 0 {
+			state, err := loadTwitterState(*statePath)
+			if err != nil {
+				log.Fatal(err)
+			}
+			src = newTwitterSource(screenNames, strings.Split(*mediaTypes, ","), state)
+		}
+	case "dir":
+		if *dir != "" {
+			src = &dirSource{root: *dir, label: *label}
+		}
+	case "urls":
+		switch *urls {
+		case "":
+		case "-":
+			src = &urlsSource{r: os.Stdin, label: *label}
+		default:
+			file, err := os.Open(*urls)
+			if err != nil {
+				log.Fatal(err)
+			}
+			defer file.Close()
+			src = &urlsSource{r: file, label: *label}
+		}
+	case "feed":
+		if *feedURL != "" {
+			src = &feedSource{url: *feedURL, label: *label}
+		}
+	default:
+		fmt.Fprintf(os.Stderr, "unknown source: %s\n", *sourceName)
+	}
+	if src == nil {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	w, err := newWriter(os.Stdout, *format)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := src.Collect(context.Background(), w.write); err != nil {
+		log.Fatal(err)
+	}
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// Output formats
+const (
+	formatTSV   = "tsv"
+	formatJSONL = "jsonl"
+)
+
+// Media types of Twitter
+const (
+	mediaTypePhoto       = "photo"
+	mediaTypeAnimatedGIF = "animated_gif"
+	mediaTypeVideo       = "video"
+)
+
+// Record is a collected photo, written as a row of the TSV read by `cmd/create_data`.
+// Fields after Label are written only in JSONL, and may be empty depending on the source.
+// PublishedAt is zero if unknown, and written as empty.
+type Record struct {
+	MediaID      string
+	PhotoURL     string
+	SourceURL    string
+	PublishedAt  time.Time
+	AuthorID     string
+	Label        string
+	MediaType    string
+	Width        int
+	Height       int
+	AltText      string
+	Text         string
+	LikeCount    int
+	RetweetCount int
+	Sensitive    bool
+}
+
+// Source emits records of photos to be collected
+type Source interface {
+	Collect(ctx context.Context, emit func(*Record) error) error
+}
+
+// writer writes records without duplicates of MediaID
+type writer struct {
+	w      io.Writer
+	format string
+	seen   map[string]bool
+}
+
+func newWriter(w io.Writer, format string) (*writer, error) {
+	switch format {
+	case formatTSV, formatJSONL:
+	default:
+		return nil, fmt.Errorf("unknown format: %s", format)
+	}
+	return &writer{
+		w:      w,
+		format: format,
+		seen:   map[string]bool{},
+	}, nil
+}
+
+func (w *writer) write(r *Record) error {
+	if w.seen[r.MediaID] {
+		return nil
+	}
+	w.seen[r.MediaID] = true
+	if w.format == formatJSONL {
+		return w.writeJSON(r)
+	}
+	return w.writeTSV(r)
+}
+
+func (w *writer) writeJSON(r *Record) error {
+	data, err := json.Marshal(&struct {
+		MediaID      string `json:"media_id"`
+		PhotoURL     string `json:"photo_url"`
+		SourceURL    string `json:"source_url"`
+		PublishedAt  string `json:"published_at,omitempty"`
+		AuthorID     string `json:"author_id,omitempty"`
+		Label        string `json:"label"`
+		MediaType    string `json:"media_type,omitempty"`
+		Width        int    `json:"width,omitempty"`
+		Height       int    `json:"height,omitempty"`
+		AltText      string `json:"alt_text,omitempty"`
+		Text         string `json:"text,omitempty"`
+		LikeCount    int    `json:"like_count"`
+		RetweetCount int    `json:"retweet_count"`
+		Sensitive    bool   `json:"sensitive"`
+	}{
+		MediaID:      r.MediaID,
+		PhotoURL:     r.PhotoURL,
+		SourceURL:    r.SourceURL,
+		PublishedAt:  formatTime(r.PublishedAt, time.RFC3339),
+		AuthorID:     r.AuthorID,
+		Label:        r.Label,
+		MediaType:    r.MediaType,
+		Width:        r.Width,
+		Height:       r.Height,
+		AltText:      r.AltText,
+		Text:         r.Text,
+		LikeCount:    r.LikeCount,
+		RetweetCount: r.RetweetCount,
+		Sensitive:    r.Sensitive,
+	})
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w.w, "%s\n", data)
+	return err
+}
+
+func (w *writer) writeTSV(r *Record) error {
+	columns := []string{
+		r.MediaID,
+		r.PhotoURL,
+		r.SourceURL,
+		// in the format of Twitter API, parsed by `cmd/create_data`
+		formatTime(r.PublishedAt, time.RubyDate),
+		r.AuthorID,
+		r.Label,
+	}
+	for i, column := range columns {
+		columns[i] = strings.NewReplacer("\t", " ", "\n", " ").Replace(column)
+	}
+	_, err := fmt.Fprintln(w.w, strings.Join(columns, "\t"))
+	return err
+}
+
+// formatTime returns an empty string for the zero time
+func formatTime(t time.Time, layout string) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.UTC().Format(layout)
+}
+
+// mediaID returns the ID of the photo of sources other than Twitter,
+// unique for each URL, which is also used as the file name of the output of `cmd/create_data`
+func mediaID(photoURL string) string {
+	sum := sha256.Sum256([]byte(photoURL))
+	return hex.EncodeToString(sum[:16])
+}
+
+// mediaPath returns the URL without query and fragment
+func mediaPath(photoURL string) string {
+	if i := strings.IndexAny(photoURL, "?#"); i >= 0 {
+		return photoURL[:i]
+	}
+	return photoURL
+}
@@ -0,0 +1,224 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/dghubble/go-twitter/twitter"
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/clientcredentials"
+)
+
+// upper limit of tweets to go back per account, by the API
+const maxTimelinePages = 16
+
+const userTimelineURL = "https://api.twitter.com/1.1/statuses/user_timeline.json"
+
+// timelineTweet is a tweet with alt texts of media,
+// which are not supported by `twitter.Timelines`
+type timelineTweet struct {
+	twitter.Tweet
+	ExtendedEntities *struct {
+		Media []struct {
+			twitter.MediaEntity
+			ExtAltText string `json:"ext_alt_text"`
+		} `json:"media"`
+	} `json:"extended_entities"`
+}
+
+// twitterSource collects photos of the user timelines,
+// from the newest tweet back to the last one collected
+type twitterSource struct {
+	client      *http.Client
+	screenNames []string
+	mediaTypes  map[string]bool
+	state       *twitterState
+}
+
+func newTwitterSource(screenNames []string, mediaTypes []string, state *twitterState) *twitterSource {
+	config := &clientcredentials.Config{
+		ClientID:     os.Getenv("CONSUMER_KEY"),
+		ClientSecret: os.Getenv("CONSUMER_SECRET"),
+		TokenURL:     "https://api.twitter.com/oauth2/token",
+	}
+	types := map[string]bool{}
+	for _, mediaType := range mediaTypes {
+		types[mediaType] = true
+	}
+	return &twitterSource{
+		client:      config.Client(oauth2.NoContext),
+		screenNames: screenNames,
+		mediaTypes:  types,
+		state:       state,
+	}
+}
+
+func (s *twitterSource) Collect(ctx context.Context, emit func(*Record) error) error {
+	failed := 0
+	for _, screenName := range s.screenNames {
+		sinceID, err := s.collectTimeline(ctx, screenName, emit)
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			// protected, suspended or renamed accounts do not stop the others
+			log.Printf("failed to collect %s: %s", screenName, err.Error())
+			failed++
+			continue
+		}
+		// saved per account, a failure of the other accounts does not lose progress
+		if sinceID > s.state.SinceID[screenName] {
+			s.state.SinceID[screenName] = sinceID
+			if err := s.state.save(); err != nil {
+				return err
+			}
+		}
+	}
+	if failed > 0 {
+		log.Printf("failed to collect %d of %d accounts", failed, len(s.screenNames))
+	}
+	return nil
+}
+
+// collectTimeline emits photos of the tweets newer than the last run, and returns the newest tweet ID
+func (s *twitterSource) collectTimeline(ctx context.Context, screenName string, emit func(*Record) error) (int64, error) {
+	sinceID := s.state.SinceID[screenName]
+	newest, maxID := sinceID, int64(0)
+	skipped := map[string]int{}
+	for i := 0; i < maxTimelinePages; i++ {
+		tweets, err := s.userTimeline(ctx, screenName, sinceID, maxID)
+		if err != nil {
+			return 0, err
+		}
+		if len(tweets) == 0 {
+			break
+		}
+		for _, tweet := range tweets {
+			if tweet.ID > newest {
+				newest = tweet.ID
+			}
+			maxID = tweet.ID - 1
+			if tweet.ExtendedEntities == nil {
+				continue
+			}
+			createdAt, err := tweet.CreatedAtTime()
+			if err != nil {
+				return 0, err
+			}
+			for _, media := range tweet.ExtendedEntities.Media {
+				if !s.mediaTypes[media.Type] {
+					skipped[media.Type]++
+					continue
+				}
+				if err := emit(&Record{
+					MediaID:      media.IDStr,
+					PhotoURL:     media.MediaURLHttps,
+					SourceURL:    fmt.Sprintf("https://twitter.com/%s/status/%s", screenName, tweet.IDStr),
+					PublishedAt:  createdAt,
+					AuthorID:     tweet.User.IDStr,
+					Label:        screenName,
+					MediaType:    media.Type,
+					Width:        media.Sizes.Large.Width,
+					Height:       media.Sizes.Large.Height,
+					AltText:      media.ExtAltText,
+					Text:         tweet.FullText,
+					LikeCount:    tweet.FavoriteCount,
+					RetweetCount: tweet.RetweetCount,
+					Sensitive:    tweet.PossiblySensitive,
+				}); err != nil {
+					return 0, err
+				}
+			}
+		}
+	}
+	for mediaType, n := range skipped {
+		log.Printf("%s: skipped %d media of %s", screenName, n, mediaType)
+	}
+	return newest, nil
+}
+
+// userTimeline requests the timeline, waiting for the reset of the rate limit if exceeded
+func (s *twitterSource) userTimeline(ctx context.Context, screenName string, sinceID, maxID int64) ([]timelineTweet, error) {
+	params := url.Values{}
+	params.Set("screen_name", screenName)
+	params.Set("count", "200")
+	params.Set("trim_user", "true")
+	params.Set("exclude_replies", "true")
+	params.Set("include_rts", "false")
+	params.Set("tweet_mode", "extended")
+	params.Set("include_ext_alt_text", "true")
+	if sinceID > 0 {
+		params.Set("since_id", strconv.FormatInt(sinceID, 10))
+	}
+	if maxID > 0 {
+		params.Set("max_id", strconv.FormatInt(maxID, 10))
+	}
+	for {
+		req, err := http.NewRequest(http.MethodGet, userTimelineURL+"?"+params.Encode(), nil)
+		if err != nil {
+			return nil, err
+		}
+		resp, err := s.client.Do(req.WithContext(ctx))
+		if err != nil {
+			return nil, err
+		}
+		if resp.StatusCode == http.StatusTooManyRequests {
+			resp.Body.Close()
+			if err := waitRateLimit(ctx, resp.Header); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		tweets, err := decodeTimeline(resp)
+		if err != nil {
+			return nil, err
+		}
+		if resp.Header.Get("x-rate-limit-remaining") == "0" {
+			if err := waitRateLimit(ctx, resp.Header); err != nil {
+				return nil, err
+			}
+		}
+		return tweets, nil
+	}
+}
+
+func decodeTimeline(resp *http.Response) ([]timelineTweet, error) {
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		var apiError twitter.APIError
+		if err := json.NewDecoder(resp.Body).Decode(&apiError); err != nil || apiError.Empty() {
+			return nil, fmt.Errorf("twitter: %s", resp.Status)
+		}
+		return nil, apiError
+	}
+	tweets := []timelineTweet{}
+	if err := json.NewDecoder(resp.Body).Decode(&tweets); err != nil {
+		return nil, err
+	}
+	return tweets, nil
+}
+
+// waitRateLimit sleeps until the time of `x-rate-limit-reset`
+func waitRateLimit(ctx context.Context, header http.Header) error {
+	wait := time.Minute
+	if reset, err := strconv.ParseInt(header.Get("x-rate-limit-reset"), 10, 64); err == nil {
+		wait = time.Until(time.Unix(reset, 0)) + time.Second
+	}
+	if wait <= 0 {
+		return nil
+	}
+	log.Printf("rate limit exceeded, waiting %s", wait.Round(time.Second))
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-time.After(wait):
+		return nil
+	}
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"strings"
+)
+
+// urlsSource collects photos listed as lines of `<URL>` or `<URL>\t<label>`, without published time
+type urlsSource struct {
+	r     io.Reader
+	label string
+}
+
+func (s *urlsSource) Collect(ctx context.Context, emit func(*Record) error) error {
+	scanner := bufio.NewScanner(s.r)
+	for scanner.Scan() {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.SplitN(line, "\t", 2)
+		label := s.label
+		if len(fields) > 1 {
+			label = strings.TrimSpace(fields[1])
+		}
+		if err := emit(&Record{
+			MediaID:   mediaID(fields[0]),
+			PhotoURL:  fields[0],
+			SourceURL: fields[0],
+			Label:     label,
+			MediaType: mediaTypePhoto,
+		}); err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}
@@ -35,10 +35,11 @@ func run(projectID string) error {
 
 	// count all images
 	stats := []*entity.Count{
-		&entity.Count{},
-		&entity.Count{},
-		&entity.Count{},
+		&entity.Count{Tags: map[string]int{}},
+		&entity.Count{Tags: map[string]int{}},
+		&entity.Count{Tags: map[string]int{}},
 	}
+	labels := map[string]*entity.Label{}
 	query := fsClient.Collection(entity.KindNameImage).Query
 	iter := query.Documents(ctx)
 	i := 0
@@ -66,7 +67,39 @@ func run(projectID string) error {
 					stats[i].Pending++
 				case entity.StatusOK:
 					stats[i].OK++
+				case entity.StatusPredicted:
+					stats[i].Predicted++
+				case entity.StatusDeleted:
+					stats[i].Deleted++
 				}
+				// tag counts exclude images in the trash
+				if image.Status == entity.StatusDeleted {
+					continue
+				}
+				for _, tag := range image.Tags {
+					stats[i].Tags[tag]++
+				}
+			}
+		}
+		if image.LabelName != "" {
+			label, ok := labels[image.LabelName]
+			if !ok {
+				label = &entity.Label{Name: image.LabelName}
+				labels[image.LabelName] = label
+			}
+			switch image.Status {
+			case entity.StatusReady:
+				label.Ready++
+			case entity.StatusNG:
+				label.NG++
+			case entity.StatusPending:
+				label.Pending++
+			case entity.StatusOK:
+				label.OK++
+			case entity.StatusPredicted:
+				label.Predicted++
+			case entity.StatusDeleted:
+				label.Deleted++
 			}
 		}
 		i++
@@ -82,5 +115,24 @@ func run(projectID string) error {
 			return err
 		}
 	}
+	// update labels
+	batch := fsClient.Batch()
+	n := 0
+	for name, label := range labels {
+		batch.Set(fsClient.Collection(entity.KindNameLabel).Doc(entity.LabelDocID(name)), label)
+		n++
+		if n%500 == 0 {
+			if _, err := batch.Commit(ctx); err != nil {
+				return err
+			}
+			batch = fsClient.Batch()
+		}
+	}
+	if n%500 != 0 {
+		if _, err := batch.Commit(ctx); err != nil {
+			return err
+		}
+	}
+	log.Printf("%d labels", n)
 	return nil
 }
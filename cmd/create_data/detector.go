@@ -0,0 +1,92 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// detector talks to an external process which detects a face, one JSON object per line.
+//
+// Request written to stdin:
+//
+//	{"id": "<photo ID>", "image": "<base64 of the downloaded photo>"}
+//
+// Response read from stdout, `face` is empty if no face is detected:
+//
+//	{"id": "<photo ID>", "face": "<base64 JPEG of the cropped face>", "parts": [[x, y], ...], "angle": 0.0, "size": 0}
+//	{"id": "<photo ID>", "error": "<message>"}
+type detector struct {
+	cmd    *exec.Cmd
+	stdin  io.WriteCloser
+	stdout *bufio.Reader
+}
+
+type detectRequest struct {
+	ID    string `json:"id"`
+	Image []byte `json:"image"`
+}
+
+type detectResponse struct {
+	ID    string   `json:"id"`
+	Face  []byte   `json:"face"`
+	Parts [][2]int `json:"parts"`
+	Angle float64  `json:"angle"`
+	Size  int      `json:"size"`
+	Error string   `json:"error"`
+}
+
+func newDetector(command string) (*detector, error) {
+	args := strings.Fields(command)
+	if len(args) == 0 {
+		return nil, errors.New("empty detector command")
+	}
+	cmd := exec.Command(args[0], args[1:]...)
+	cmd.Stderr = os.Stderr
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+	return &detector{
+		cmd:    cmd,
+		stdin:  stdin,
+		stdout: bufio.NewReader(stdout),
+	}, nil
+}
+
+// detect returns the response of the photo, with `Error` if the detector failed on it.
+// An error is returned only if the process does not follow the protocol.
+func (d *detector) detect(id string, image []byte) (*detectResponse, error) {
+	if err := json.NewEncoder(d.stdin).Encode(&detectRequest{ID: id, Image: image}); err != nil {
+		return nil, fmt.Errorf("detector: %w", err)
+	}
+	line, err := d.stdout.ReadBytes('\n')
+	if err != nil {
+		return nil, fmt.Errorf("detector: %w", err)
+	}
+	var resp detectResponse
+	if err := json.Unmarshal(line, &resp); err != nil {
+		return nil, fmt.Errorf("detector: %w", err)
+	}
+	if resp.ID != id {
+		return nil, fmt.Errorf("detector: response of %s, expected %s", resp.ID, id)
+	}
+	return &resp, nil
+}
+
+func (d *detector) close() error {
+	d.stdin.Close()
+	return d.cmd.Wait()
+}
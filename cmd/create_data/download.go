@@ -0,0 +1,80 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"time"
+)
+
+// downloader fetches photos, retrying temporary failures with exponential backoff
+type downloader struct {
+	client  *http.Client
+	retries int
+}
+
+// httpError is a failure of the response, retried only if temporary
+type httpError struct {
+	url        string
+	statusCode int
+}
+
+func (e *httpError) Error() string {
+	return fmt.Sprintf("%s: %s", e.url, http.StatusText(e.statusCode))
+}
+
+func (e *httpError) temporary() bool {
+	return e.statusCode == http.StatusTooManyRequests || e.statusCode >= 500
+}
+
+func newDownloader(retries int) *downloader {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	// photos in a local directory, collected by `-source dir`
+	transport.RegisterProtocol("file", http.NewFileTransport(http.Dir("/")))
+	return &downloader{
+		client: &http.Client{
+			Transport: transport,
+			Timeout:   time.Minute,
+		},
+		retries: retries,
+	}
+}
+
+func (d *downloader) download(ctx context.Context, url string) ([]byte, error) {
+	wait := time.Second
+	for i := 0; ; i++ {
+		data, err := d.get(ctx, url)
+		if err == nil {
+			return data, nil
+		}
+		if e, ok := err.(*httpError); ok && !e.temporary() {
+			return nil, err
+		}
+		if i == d.retries {
+			return nil, err
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(wait):
+		}
+		wait *= 2
+	}
+}
+
+func (d *downloader) get(ctx context.Context, url string) ([]byte, error) {
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := d.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, &httpError{url: url, statusCode: resp.StatusCode}
+	}
+	return ioutil.ReadAll(resp.Body)
+}
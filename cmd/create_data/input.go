@@ -0,0 +1,105 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// layout of `published_at` expected by `cmd/upload_images`
+const publishedAtLayout = "2006-01-02T15:04:05"
+
+// meta is written as `meta` of the JSON file, read by `cmd/upload_images`
+type meta struct {
+	PhotoID     string `json:"photo_id"`
+	PhotoURL    string `json:"photo_url"`
+	SourceURL   string `json:"source_url"`
+	PublishedAt string `json:"published_at,omitempty"`
+	LabelID     string `json:"label_id"`
+	LabelName   string `json:"label_name"`
+}
+
+// readRecords reads the output of `cmd/collect_images`, in TSV or JSONL
+func readRecords(r io.Reader, jsonl bool) (<-chan *meta, <-chan error) {
+	metaCh, errCh := make(chan *meta), make(chan error, 1)
+	go func() {
+		defer close(metaCh)
+		scanner := bufio.NewScanner(r)
+		scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+		for line := 1; scanner.Scan(); line++ {
+			if strings.TrimSpace(scanner.Text()) == "" {
+				continue
+			}
+			parse := parseTSV
+			if jsonl {
+				parse = parseJSONL
+			}
+			m, err := parse(scanner.Text())
+			if err != nil {
+				errCh <- fmt.Errorf("line %d: %w", line, err)
+				return
+			}
+			metaCh <- m
+		}
+		if err := scanner.Err(); err != nil {
+			errCh <- err
+		}
+	}()
+	return metaCh, errCh
+}
+
+func parseTSV(line string) (*meta, error) {
+	columns := strings.Split(line, "\t")
+	if len(columns) < 6 {
+		return nil, fmt.Errorf("%d columns, expected 6", len(columns))
+	}
+	publishedAt := time.Time{}
+	if columns[3] != "" {
+		t, err := time.Parse(time.RubyDate, columns[3])
+		if err != nil {
+			return nil, err
+		}
+		publishedAt = t
+	}
+	return &meta{
+		PhotoID:     columns[0],
+		PhotoURL:    columns[1],
+		SourceURL:   columns[2],
+		PublishedAt: formatPublishedAt(publishedAt),
+		LabelID:     columns[4],
+		LabelName:   columns[5],
+	}, nil
+}
+
+func parseJSONL(line string) (*meta, error) {
+	var record struct {
+		MediaID     string    `json:"media_id"`
+		PhotoURL    string    `json:"photo_url"`
+		SourceURL   string    `json:"source_url"`
+		PublishedAt time.Time `json:"published_at"`
+		AuthorID    string    `json:"author_id"`
+		Label       string    `json:"label"`
+	}
+	if err := json.Unmarshal([]byte(line), &record); err != nil {
+		return nil, err
+	}
+	return &meta{
+		PhotoID:     record.MediaID,
+		PhotoURL:    record.PhotoURL,
+		SourceURL:   record.SourceURL,
+		PublishedAt: formatPublishedAt(record.PublishedAt),
+		LabelID:     record.AuthorID,
+		LabelName:   record.Label,
+	}, nil
+}
+
+// formatPublishedAt returns an empty string if the published time is unknown
+func formatPublishedAt(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.UTC().Format(publishedAtLayout)
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/sugyan/image-dataset/web/quality"
+)
+
+type job struct {
+	meta  *meta
+	out   string
+	image []byte
+	// of the downloaded photo, as the detector re-encodes the face
+	jpegQuality int
+}
+
+func main() {
+	datafile := flag.String("datafile", "python/data.tsv", "output of collect_images, in JSONL if the extension is .jsonl")
+	datadir := flag.String("datadir", "python/data", "data directory")
+	command := flag.String("detector", "python python/detector.py", "command of the detector process")
+	concurrency := flag.Int("concurrency", 10, "number of concurrent downloads")
+	detectors := flag.Int("detectors", 1, "number of detector processes")
+	retries := flag.Int("retries", 3, "number of retries of a failed download")
+	flag.Parse()
+	if *concurrency < 1 || *detectors < 1 || *retries < 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	file, err := os.Open(*datafile)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer file.Close()
+	metaCh, readErrCh := readRecords(file, strings.HasSuffix(*datafile, ".jsonl"))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	jobCh := download(ctx, metaCh, *datadir, newDownloader(*retries), *concurrency)
+
+	errCh := make(chan error, *detectors)
+	wg := sync.WaitGroup{}
+	for i := 0; i < *detectors; i++ {
+		d, err := newDetector(*command)
+		if err != nil {
+			log.Fatal(err)
+		}
+		wg.Add(1)
+		go func(d *detector) {
+			defer wg.Done()
+			if err := detect(d, jobCh); err != nil {
+				errCh <- err
+			}
+		}(d)
+	}
+	go func() {
+		wg.Wait()
+		close(errCh)
+	}()
+	for err := range errCh {
+		log.Fatal(err)
+	}
+	select {
+	case err := <-readErrCh:
+		log.Fatal(err)
+	default:
+	}
+	log.Println("finish")
+}
+
+// download fetches photos of the records whose output does not exist yet
+func download(ctx context.Context, metaCh <-chan *meta, datadir string, d *downloader, concurrency int) <-chan *job {
+	jobCh := make(chan *job)
+	wg := sync.WaitGroup{}
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for m := range metaCh {
+				out, err := outputPath(datadir, m)
+				if err != nil {
+					log.Println(err)
+					continue
+				}
+				if exists(out) {
+					continue
+				}
+				image, err := d.download(ctx, m.PhotoURL)
+				if err != nil {
+					log.Printf("%s: %s", m.PhotoURL, err.Error())
+					continue
+				}
+				jobCh <- &job{meta: m, out: out, image: image, jpegQuality: quality.EstimateJPEGQuality(image)}
+			}
+		}()
+	}
+	go func() {
+		wg.Wait()
+		close(jobCh)
+	}()
+	return jobCh
+}
+
+// detect sends photos to the detector and saves detected faces
+func detect(d *detector, jobCh <-chan *job) error {
+	for job := range jobCh {
+		resp, err := d.detect(job.meta.PhotoID, job.image)
+		if err != nil {
+			return err
+		}
+		switch {
+		case resp.Error != "":
+			log.Printf("%s: %s", job.meta.PhotoURL, resp.Error)
+		case len(resp.Face) == 0:
+			log.Printf("%s: no face", job.meta.PhotoURL)
+		default:
+			if err := save(job.out, job.meta, job.jpegQuality, resp); err != nil {
+				return err
+			}
+			log.Printf("%s: %s.json", job.meta.PhotoURL, job.out)
+		}
+	}
+	return d.close()
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// data is the JSON file read by `cmd/upload_images`
+type data struct {
+	Angle float64  `json:"angle"`
+	Size  int      `json:"size"`
+	Parts [][2]int `json:"parts"`
+	Meta  *meta    `json:"meta"`
+	// estimated from the source photo, omitted if it is not JPEG
+	JPEGQuality int `json:"jpeg_quality,omitempty"`
+}
+
+// host of Twitter media, whose files are named after the media key as they have been
+const twitterMediaHost = "pbs.twimg.com"
+
+// outputPath returns the path without extension of the photo,
+// in directories of the hex codes of the first 3 characters of its name.
+// The name is the photo ID, unique for each source URL of `cmd/collect_images`.
+func outputPath(datadir string, m *meta) (string, error) {
+	name := m.PhotoID
+	if u, err := url.Parse(m.PhotoURL); err == nil && u.Host == twitterMediaHost {
+		base := path.Base(u.Path)
+		name = strings.TrimSuffix(base, path.Ext(base))
+	}
+	chars := []rune(name)
+	if len(chars) < 3 || strings.ContainsAny(name, `/\`) || strings.HasPrefix(name, ".") {
+		return "", fmt.Errorf("invalid photo name: %s", name)
+	}
+	return filepath.Join(
+		datadir,
+		fmt.Sprintf("%02x", chars[0]),
+		fmt.Sprintf("%02x", chars[1]),
+		fmt.Sprintf("%02x", chars[2]),
+		name,
+	), nil
+}
+
+func exists(out string) bool {
+	_, err := os.Stat(out + ".json")
+	return err == nil
+}
+
+// save writes the face image and its JSON, the JSON last as it marks completion
+func save(out string, m *meta, jpegQuality int, resp *detectResponse) error {
+	if err := os.MkdirAll(filepath.Dir(out), 0755); err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(out+".jpg", resp.Face, 0644); err != nil {
+		return err
+	}
+	b, err := json.Marshal(&data{
+		Angle:       resp.Angle,
+		Size:        resp.Size,
+		Parts:       resp.Parts,
+		Meta:        m,
+		JPEGQuality: jpegQuality,
+	})
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(out+".json", b, 0644)
+}
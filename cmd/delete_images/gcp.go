@@ -5,10 +5,14 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"time"
 
 	"cloud.google.com/go/firestore"
 	"cloud.google.com/go/storage"
 	"github.com/sugyan/image-dataset/web/entity"
+	"github.com/sugyan/image-dataset/web/purge"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 )
 
 type gcp struct {
@@ -38,22 +42,179 @@ func newGcp(projectID string) (*gcp, error) {
 	}, nil
 }
 
-func (g *gcp) delete(ctx context.Context, images []*entity.Image) error {
-	batch := g.fsClient.Batch()
-	for _, image := range images {
-		// delete from storage
-		log.Printf("image %s: (size: %d)", image.ID, image.Size)
-		obj := g.csClient.Bucket(g.bucketName).Object(fmt.Sprintf("images/%s", image.ID))
-		if err := obj.Delete(ctx); err != nil {
-			log.Printf("failed to delete object: %v", obj)
-			// continue to delete
+// deleteDocuments deletes images and decrements their counts in a transaction,
+// deletes their votes and comments, and returns the images which have been deleted
+func (g *gcp) deleteDocuments(ctx context.Context, images []*entity.Image) ([]*entity.Image, error) {
+	deleted := []*entity.Image{}
+	err := g.fsClient.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		deleted = []*entity.Image{}
+		refs := []*firestore.DocumentRef{}
+		for _, image := range images {
+			refs = append(refs, g.fsClient.Collection(entity.KindNameImage).Doc(image.ID))
+		}
+		documents, err := tx.GetAll(refs)
+		if err != nil {
+			return err
+		}
+		// count with the current data, which may be changed after listing
+		counts := []map[string]int{{}, {}, {}}
+		labels := map[string]map[entity.Status]int{}
+		for _, document := range documents {
+			if !document.Exists() {
+				continue
+			}
+			var image entity.Image
+			if err := document.DataTo(&image); err != nil {
+				return err
+			}
+			for i, b := range []bool{image.Size0256, image.Size0512, image.Size1024} {
+				if b {
+					counts[i][image.Status.Path()]--
+					// images in the trash are already excluded from tag counts
+					if image.Status == entity.StatusDeleted {
+						continue
+					}
+					for _, tag := range image.Tags {
+						counts[i]["Tags."+tag]--
+					}
+				}
+			}
+			if image.LabelName != "" {
+				if _, ok := labels[image.LabelName]; !ok {
+					labels[image.LabelName] = map[entity.Status]int{}
+				}
+				labels[image.LabelName][image.Status]--
+			}
+			deleted = append(deleted, &image)
+		}
+		for _, document := range documents {
+			if !document.Exists() {
+				continue
+			}
+			if err := tx.Delete(document.Ref); err != nil {
+				return err
+			}
+		}
+		return g.updateCounts(tx, counts, labels)
+	})
+	if err != nil {
+		return nil, err
+	}
+	for _, image := range deleted {
+		if err := purge.DeleteSubcollections(ctx, g.fsClient, image.ID); err != nil {
+			return nil, err
+		}
+	}
+	return deleted, nil
+}
+
+// trashDocuments moves images to the trash and updates their counts in a transaction
+func (g *gcp) trashDocuments(ctx context.Context, images []*entity.Image) error {
+	return g.fsClient.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		refs := []*firestore.DocumentRef{}
+		for _, image := range images {
+			refs = append(refs, g.fsClient.Collection(entity.KindNameImage).Doc(image.ID))
+		}
+		documents, err := tx.GetAll(refs)
+		if err != nil {
+			return err
+		}
+		now := time.Now()
+		counts := []map[string]int{{}, {}, {}}
+		labels := map[string]map[entity.Status]int{}
+		trashed := []*entity.Image{}
+		for _, document := range documents {
+			if !document.Exists() {
+				continue
+			}
+			var image entity.Image
+			if err := document.DataTo(&image); err != nil {
+				return err
+			}
+			if image.Status == entity.StatusDeleted {
+				continue
+			}
+			for i, b := range []bool{image.Size0256, image.Size0512, image.Size1024} {
+				if b {
+					counts[i][image.Status.Path()]--
+					counts[i][entity.StatusDeleted.Path()]++
+					for _, tag := range image.Tags {
+						counts[i]["Tags."+tag]--
+					}
+				}
+			}
+			if image.LabelName != "" {
+				if _, ok := labels[image.LabelName]; !ok {
+					labels[image.LabelName] = map[entity.Status]int{}
+				}
+				labels[image.LabelName][image.Status]--
+				labels[image.LabelName][entity.StatusDeleted]++
+			}
+			trashed = append(trashed, &image)
+		}
+		for _, image := range trashed {
+			ref := g.fsClient.Collection(entity.KindNameImage).Doc(image.ID)
+			if err := tx.Update(ref, []firestore.Update{
+				{Path: "Status", Value: entity.StatusDeleted},
+				{Path: "PreviousStatus", Value: image.Status},
+				{Path: "DeletedAt", Value: now},
+				{Path: "UpdatedAt", Value: now},
+				{Path: "LeasedBy", Value: ""},
+				{Path: "LeasedUntil", Value: time.Time{}},
+			}); err != nil {
+				return err
+			}
+		}
+		return g.updateCounts(tx, counts, labels)
+	})
+}
+
+// updateCounts applies differences of counts for each size and each label
+func (g *gcp) updateCounts(tx *firestore.Transaction, counts []map[string]int, labels map[string]map[entity.Status]int) error {
+	for i, count := range counts {
+		if len(count) > 0 {
+			docID := []string{"0256", "0512", "1024"}[i]
+			ref := g.fsClient.Collection(entity.KindNameCount).Doc(docID)
+			updates := []firestore.Update{}
+			for path, v := range count {
+				updates = append(updates, firestore.Update{
+					Path:  path,
+					Value: firestore.Increment(v),
+				})
+			}
+			if err := tx.Update(ref, updates); err != nil {
+				return err
+			}
 		}
-		// delete from firestore
-		docRef := g.fsClient.Collection(entity.KindNameImage).Doc(image.ID)
-		batch.Delete(docRef)
 	}
-	if _, err := batch.Commit(ctx); err != nil {
-		return err
+	for labelName, count := range labels {
+		ref := g.fsClient.Collection(entity.KindNameLabel).Doc(entity.LabelDocID(labelName))
+		data := map[string]interface{}{
+			"Name": labelName,
+		}
+		for k, v := range count {
+			data[k.Path()] = firestore.Increment(v)
+		}
+		if err := tx.Set(ref, data, firestore.MergeAll); err != nil {
+			return err
+		}
 	}
 	return nil
 }
+
+// deleteObjects deletes files of images from storage,
+// and returns names of objects failed to delete
+func (g *gcp) deleteObjects(ctx context.Context, images []*entity.Image) []string {
+	failed := []string{}
+	for _, image := range images {
+		name := fmt.Sprintf("images/%s", image.ID)
+		if err := g.csClient.Bucket(g.bucketName).Object(name).Delete(ctx); err != nil {
+			if status.Code(err) == codes.NotFound || err == storage.ErrObjectNotExist {
+				continue
+			}
+			log.Printf("failed to delete object %s: %s", name, err.Error())
+			failed = append(failed, name)
+		}
+	}
+	return failed
+}
@@ -1,96 +1,307 @@
 package main
 
 import (
+	"bufio"
 	"context"
 	"errors"
 	"flag"
 	"fmt"
 	"log"
 	"os"
+	"strconv"
+	"strings"
+	"time"
 
 	"cloud.google.com/go/firestore"
 	"github.com/sugyan/image-dataset/web/entity"
+	"github.com/sugyan/image-dataset/web/queryspec"
 	"google.golang.org/api/iterator"
 )
 
+// number of images deleted in a transaction, within the limit of writes
+const chunkSize = 200
+
+var (
+	projectID  string
+	name       string
+	statusName string
+	size       string
+	below      string
+	tag        string
+	all        bool
+	dryRun     bool
+	yes        bool
+	permanent  bool
+	// date range parameter -> value
+	afters  = map[string]*string{}
+	befores = map[string]*string{}
+)
+
+var statuses = []entity.Status{
+	entity.StatusReady, entity.StatusNG, entity.StatusPending, entity.StatusOK, entity.StatusPredicted, entity.StatusDeleted,
+}
+
+func init() {
+	flag.StringVar(&projectID, "projectID", "", "project ID")
+	flag.StringVar(&name, "name", "", "target label name")
+	flag.StringVar(&statusName, "status", "", "target status (Ready, NG, Pending, OK, Predicted, Deleted)")
+	flag.StringVar(&size, "size", "", "target images of at least the size (256, 512, 1024)")
+	flag.StringVar(&below, "below", "", "target images smaller than the size (256, 512, 1024)")
+	flag.StringVar(&tag, "tag", "", "target tag")
+	flag.BoolVar(&all, "all", false, "target all images, required without any filter")
+	flag.BoolVar(&dryRun, "dry-run", false, "list target images without deleting")
+	flag.BoolVar(&yes, "yes", false, "delete without confirmation")
+	flag.BoolVar(&permanent, "permanent", false, "delete from the database and storage instead of moving to the trash")
+	for key := range queryspec.Image.DateRanges {
+		afters[key] = flag.String(key+"_after", "", fmt.Sprintf("target images %s at or after the time", key))
+		befores[key] = flag.String(key+"_before", "", fmt.Sprintf("target images %s before the time", key))
+	}
+}
+
 func main() {
-	projectID := flag.String("projectID", "", "project ID")
 	flag.Parse()
-	if *projectID == "" {
+	if projectID == "" {
 		flag.Usage()
 		os.Exit(2)
 	}
-	if err := run(context.Background(), *projectID); err != nil {
+	if !all && !hasFilter() {
+		fmt.Fprintln(os.Stderr, "no filter is specified, use -all to target all images")
+		os.Exit(2)
+	}
+	failed, err := run(context.Background())
+	if err != nil {
 		log.Fatal(err)
 	}
+	if len(failed) > 0 {
+		log.Printf("failed to delete %d objects from storage:", len(failed))
+		for _, name := range failed {
+			log.Printf("  %s", name)
+		}
+		os.Exit(1)
+	}
+	log.Println("finish")
 }
 
-func run(ctx context.Context, projectID string) error {
+// hasFilter reports whether any filter of target images is specified
+func hasFilter() bool {
+	if name != "" || statusName != "" || size != "" || below != "" || tag != "" {
+		return true
+	}
+	for key := range queryspec.Image.DateRanges {
+		if *afters[key] != "" || *befores[key] != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// run deletes target images and returns names of storage objects failed to delete
+func run(ctx context.Context) ([]string, error) {
 	gcp, err := newGcp(projectID)
 	if err != nil {
-		return err
+		return nil, err
+	}
+	query, match, err := makeQuery(gcp.fsClient)
+	if err != nil {
+		return nil, err
 	}
-	query := gcp.fsClient.Collection(entity.KindNameImage).
-		Where("Size0512", "==", false).
-		OrderBy("ID", firestore.Asc)
 
+	// collect all targets before deleting, not to page over deleted documents
+	images := []*entity.Image{}
 	for {
-		if err := gcp.fsClient.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
-			iter := query.Limit(200).Documents((ctx))
-			images := []*entity.Image{}
-			for {
-				document, err := iter.Next()
-				if err != nil {
-					if errors.Is(err, iterator.Done) {
-						break
-					} else {
-						return err
-					}
+		n := 0
+		iter := query.Limit(500).Documents(ctx)
+		for {
+			document, err := iter.Next()
+			if err != nil {
+				if errors.Is(err, iterator.Done) {
+					break
+				} else {
+					return nil, err
 				}
-				query = query.StartAfter(document)
+			}
+			query = query.StartAfter(document)
+			n++
 
-				var image entity.Image
-				if err := document.DataTo(&image); err != nil {
-					return err
-				}
+			var image entity.Image
+			if err := document.DataTo(&image); err != nil {
+				return nil, err
+			}
+			if match(&image) {
 				images = append(images, &image)
 			}
-			if len(images) == 0 {
-				return fmt.Errorf("Finised")
+		}
+		if n == 0 {
+			break
+		}
+	}
+
+	totals := map[entity.Status]int{}
+	for _, image := range images {
+		if dryRun {
+			log.Printf("image %s: (size: %d, status: %s, label: %s)", image.ID, image.Size, image.Status.Path(), image.LabelName)
+		}
+		totals[image.Status]++
+	}
+	for _, s := range statuses {
+		if totals[s] > 0 {
+			log.Printf("%s: %d", s.Path(), totals[s])
+		}
+	}
+	log.Printf("%d images to delete", len(images))
+	if dryRun || len(images) == 0 {
+		return nil, nil
+	}
+	if !yes && !confirm(fmt.Sprintf("delete %d images?", len(images))) {
+		return nil, errors.New("canceled")
+	}
+
+	failed := []string{}
+	for i := 0; i < len(images); i += chunkSize {
+		end := i + chunkSize
+		if end > len(images) {
+			end = len(images)
+		}
+		if permanent {
+			deleted, err := gcp.deleteDocuments(ctx, images[i:end])
+			if err != nil {
+				return nil, err
+			}
+			failed = append(failed, gcp.deleteObjects(ctx, deleted)...)
+			log.Printf("deleted %d/%d images", end, len(images))
+		} else {
+			if err := gcp.trashDocuments(ctx, images[i:end]); err != nil {
+				return nil, err
 			}
+			log.Printf("moved %d/%d images to the trash", end, len(images))
+		}
+	}
+	return failed, nil
+}
 
-			counts := []map[entity.Status]int{{}, {}, {}}
-			for _, image := range images {
-				for i, size := range []int{256, 512, 1024} {
-					if image.Size >= size {
-						counts[i][image.Status]++
-					}
-				}
+// makeQuery returns the query of equality filters ordered by ID,
+// and the match function of the other filters applied to the results
+func makeQuery(fsClient *firestore.Client) (firestore.Query, func(*entity.Image) bool, error) {
+	query := fsClient.Collection(entity.KindNameImage).Query
+	specFilters := []*queryspec.Filter{}
+	where := func(path string, kind queryspec.Kind, value interface{}) {
+		op := "=="
+		if kind == queryspec.ArrayContains {
+			op = "array-contains"
+		}
+		query = query.Where(path, op, value)
+		specFilters = append(specFilters, &queryspec.Filter{Field: path, Kind: kind})
+	}
+	if name != "" {
+		where(queryspec.FieldLabelName, queryspec.Equal, name)
+	}
+	if statusName != "" {
+		s, err := parseStatus(statusName)
+		if err != nil {
+			return query, nil, err
+		}
+		where(queryspec.FieldStatus, queryspec.Equal, s)
+	}
+	if size != "" {
+		path, ok := queryspec.Image.Sizes[size]
+		if !ok {
+			return query, nil, fmt.Errorf("invalid size: %s", size)
+		}
+		where(path, queryspec.Equal, true)
+	}
+	if tag != "" {
+		where(queryspec.FieldTags, queryspec.ArrayContains, tag)
+	}
+	if !queryspec.Image.Covers(specFilters, queryspec.FieldID) {
+		return query, nil, errors.New("unsupported combination of filters")
+	}
+	query = query.OrderBy(queryspec.FieldID, firestore.Asc)
+
+	// filters which cannot be combined with ordering by ID
+	belowSize := 0
+	if below != "" {
+		if _, ok := queryspec.Image.Sizes[below]; !ok {
+			return query, nil, fmt.Errorf("invalid size: %s", below)
+		}
+		belowSize, _ = strconv.Atoi(below)
+	}
+	type timeRange struct {
+		key           string
+		after, before time.Time
+	}
+	ranges := []*timeRange{}
+	for key := range queryspec.Image.DateRanges {
+		r := &timeRange{key: key}
+		if *afters[key] != "" {
+			t, err := queryspec.ParseTime(*afters[key])
+			if err != nil {
+				return query, nil, err
 			}
-			if err := gcp.delete(ctx, images); err != nil {
-				return err
+			r.after = t
+		}
+		if *befores[key] != "" {
+			t, err := queryspec.ParseTime(*befores[key])
+			if err != nil {
+				return query, nil, err
 			}
-			log.Printf("deleted %d images", len(images))
-			for i, count := range counts {
-				if len(count) > 0 {
-					docID := []string{"0256", "0512", "1024"}[i]
-					ref := gcp.fsClient.Collection(entity.KindNameCount).Doc(docID)
-					updates := []firestore.Update{}
-					for k, v := range count {
-						updates = append(updates, firestore.Update{
-							Path:  k.Path(),
-							Value: firestore.Increment(-v),
-						})
-					}
-					if err := tx.Update(ref, updates); err != nil {
-						return err
-					}
-					log.Printf("updated counts for %s: %v", docID, count)
-				}
+			r.before = t
+		}
+		if !r.after.IsZero() || !r.before.IsZero() {
+			ranges = append(ranges, r)
+		}
+	}
+	match := func(image *entity.Image) bool {
+		if !permanent && image.Status == entity.StatusDeleted {
+			return false
+		}
+		if belowSize > 0 && image.Size >= belowSize {
+			return false
+		}
+		for _, r := range ranges {
+			t := imageTime(image, queryspec.Image.DateRanges[r.key])
+			// unknown times are not in any range, as in queries
+			if t.IsZero() {
+				return false
 			}
-			return nil
-		}); err != nil {
-			return err
+			if !r.after.IsZero() && t.Before(r.after) {
+				return false
+			}
+			if !r.before.IsZero() && !t.Before(r.before) {
+				return false
+			}
+		}
+		return true
+	}
+	return query, match, nil
+}
+
+func parseStatus(s string) (entity.Status, error) {
+	for _, st := range statuses {
+		if s == st.Path() {
+			return st, nil
 		}
 	}
+	return 0, fmt.Errorf("invalid status: %s", s)
+}
+
+func imageTime(image *entity.Image, path string) time.Time {
+	switch path {
+	case queryspec.FieldPublishedAt:
+		return image.PublishedAt
+	case queryspec.FieldUpdatedAt:
+		return image.UpdatedAt
+	case queryspec.FieldCreatedAt:
+		return image.CreatedAt
+	}
+	return time.Time{}
+}
+
+func confirm(message string) bool {
+	fmt.Fprintf(os.Stderr, "%s [y/N]: ", message)
+	answer, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil {
+		return false
+	}
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	return answer == "y" || answer == "yes"
 }
@@ -2,6 +2,7 @@ package main
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"flag"
 	"fmt"
@@ -18,6 +19,7 @@ import (
 
 	"cloud.google.com/go/firestore"
 	"github.com/sugyan/image-dataset/web/entity"
+	"github.com/sugyan/image-dataset/web/release"
 	"golang.org/x/image/draw"
 	"google.golang.org/api/iterator"
 )
@@ -28,6 +30,7 @@ var (
 	num       int
 	status    string
 	outdir    string
+	rel       string
 )
 
 func init() {
@@ -36,6 +39,7 @@ func init() {
 	flag.IntVar(&num, "num", 100, "number of dump images")
 	flag.StringVar(&status, "status", "", "target status")
 	flag.StringVar(&outdir, "outdir", "images", "path to output directory")
+	flag.StringVar(&rel, "release", "", "dump exactly the images of the release (ignores -num and -status)")
 }
 
 func main() {
@@ -62,8 +66,8 @@ func run() error {
 		}
 		filenames[file.Name()] = struct{}{}
 	}
-	// collect target urls
-	urlCh, err := query(context.Background())
+	// collect target images
+	imageCh, err := query(context.Background())
 	if err != nil {
 		return err
 	}
@@ -74,7 +78,7 @@ func run() error {
 		wg.Add(1)
 		go func(w *worker) {
 			defer wg.Done()
-			w.run(urlCh, outCh, errCh)
+			w.run(imageCh, outCh, errCh)
 		}(w)
 	}
 	go func() {
@@ -100,19 +104,45 @@ Loop:
 	// delete old files
 	for filename := range filenames {
 		os.Remove(filepath.Join(outdir, filename))
+		os.Remove(filepath.Join(outdir, strings.TrimSuffix(filename, ".jpg")+".json"))
 		log.Printf("delete %s", filename)
 	}
 
 	return nil
 }
 
-func query(ctx context.Context) (<-chan string, error) {
-	urlCh := make(chan string)
+func query(ctx context.Context) (<-chan *entity.Image, error) {
+	imageCh := make(chan *entity.Image)
 
 	client, err := firestore.NewClient(ctx, projectID)
 	if err != nil {
 		return nil, err
 	}
+	if rel != "" {
+		defer client.Close()
+		r, items, err := release.Get(ctx, client, rel)
+		if err != nil {
+			return nil, err
+		}
+		log.Printf("release %s: %d images (checksum: %s)", r.Name, r.Count, r.Checksum)
+		go func() {
+			for _, item := range items {
+				// landmarks and status as of the release
+				imageCh <- &entity.Image{
+					ID:             item.ImageID,
+					ImageURL:       item.ImageURL,
+					Size:           item.Size,
+					Status:         item.Status,
+					LabelName:      item.LabelName,
+					Parts:          item.Landmarks,
+					CorrectedParts: item.Landmarks,
+					PartsCorrected: item.PartsCorrected,
+				}
+			}
+			close(imageCh)
+		}()
+		return imageCh, nil
+	}
 	go func() {
 		defer client.Close()
 		query := client.Collection(entity.KindNameImage).
@@ -131,6 +161,9 @@ func query(ctx context.Context) (<-chan string, error) {
 			default:
 				log.Fatalf("invalid status: %s", status)
 			}
+		} else {
+			// exclude images in the trash
+			query = query.Where("Status", "in", entity.ActiveStatuses)
 		}
 		i := 0
 	Loop:
@@ -152,7 +185,7 @@ func query(ctx context.Context) (<-chan string, error) {
 				if err := document.DataTo(&image); err != nil {
 					log.Fatal(err)
 				}
-				urlCh <- image.ImageURL
+				imageCh <- &image
 				i++
 				if i == num {
 					break Loop
@@ -160,9 +193,9 @@ func query(ctx context.Context) (<-chan string, error) {
 			}
 
 		}
-		close(urlCh)
+		close(imageCh)
 	}()
-	return urlCh, nil
+	return imageCh, nil
 }
 
 type worker struct {
@@ -179,14 +212,15 @@ func newWorkers(numWorkers int) []*worker {
 	return workers
 }
 
-func (w *worker) run(urlCh <-chan string, outCh chan<- string, errCh chan<- error) {
+func (w *worker) run(imageCh <-chan *entity.Image, outCh chan<- string, errCh chan<- error) {
 	outdir, err := filepath.Abs(outdir)
 	if err != nil {
 		errCh <- err
 		return
 	}
 	kernel := draw.CatmullRom
-	for url := range urlCh {
+	for target := range imageCh {
+		url := target.ImageURL
 		outpath := filepath.Join(outdir, fmt.Sprintf("%s.jpg", path.Base(url)))
 		// check if file exists
 		_, err := os.Stat(outpath)
@@ -223,6 +257,34 @@ func (w *worker) run(urlCh <-chan string, outCh chan<- string, errCh chan<- erro
 		} else {
 			log.Printf("%s already exists", path.Base(outpath))
 		}
+		// Landmarks are always rewritten because they may be corrected after the image was saved
+		if err := writeLandmarks(strings.TrimSuffix(outpath, ".jpg")+".json", target); err != nil {
+			errCh <- err
+			return
+		}
 		outCh <- outpath
 	}
 }
+
+// writeLandmarks saves landmarks scaled to the output size, preferring manually corrected ones
+func writeLandmarks(filename string, target *entity.Image) error {
+	landmarks := target.Landmarks()
+	scale := float64(size) / float64(target.Size)
+	parts := [][2]float64{}
+	for i := 0; i+1 < len(landmarks); i += 2 {
+		parts = append(parts, [2]float64{
+			float64(landmarks[i]) * scale,
+			float64(landmarks[i+1]) * scale,
+		})
+	}
+	file, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	return json.NewEncoder(file).Encode(map[string]interface{}{
+		"id":              target.ID,
+		"parts":           parts,
+		"parts_corrected": target.PartsCorrected,
+	})
+}
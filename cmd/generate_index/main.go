@@ -2,125 +2,120 @@ package main
 
 import (
 	"encoding/json"
+	"flag"
 	"fmt"
 	"log"
 	"os"
-)
-
-const (
-	collectionImage      = "Image"
-	queryScopeCollection = "COLLECTION"
-
-	nameLabelName = "LabelName"
-	nameStatus    = "Status"
-
-	nameSize0256 = "Size0256"
-	nameSize0512 = "Size0512"
-	nameSize1024 = "Size1024"
-
-	nameID          = "ID"
-	nameUpdatedAt   = "UpdatedAt"
-	namePublishedAt = "PublishedAt"
 
-	orderAsc  = "ASCENDING"
-	orderDesc = "DESCENDING"
+	"github.com/sugyan/image-dataset/web/queryspec"
 )
 
-type indexesData struct {
-	Indexes        []*index         `json:"indexes"`
-	FieldOverrides []*fieldOverride `json:"fieldOverrides"`
-}
-
-type index struct {
-	CollectionGroup string   `json:"collectionGroup"`
-	QueryScope      string   `json:"queryScope"`
-	Fields          []*field `json:"fields"`
-}
+// maximum number of composite indexes per database
+const defaultBudget = 200
 
-type fieldOverride struct {
-	CollectionGroup string        `json:"collectionGroup"`
-	FieldPath       string        `json:"fieldPath"`
-	Indexes         []interface{} `json:"indexes"`
-}
+var (
+	check  string
+	budget int
+	merge  bool
+)
 
-type field struct {
-	FieldPath string `json:"fieldPath"`
-	Order     string `json:"order"`
+func init() {
+	flag.StringVar(&check, "check", "", "path to existing firestore.indexes.json to check")
+	flag.IntVar(&budget, "budget", defaultBudget, "maximum number of composite indexes")
+	flag.BoolVar(&merge, "merge", true, "rely on index merging for combinations of equality filters")
 }
 
 func main() {
-	indexes := []*index{}
-	for _, labelName := range []string{"", nameLabelName} {
-		fields := []*field{}
-		if labelName != "" {
-			fields = append(fields, &field{
-				FieldPath: labelName,
-				Order:     orderAsc,
-			})
-		}
-		for _, status := range []string{"", nameStatus} {
-			fields := fields
-			if status != "" {
-				fields = append(fields, &field{
-					FieldPath: status,
-					Order:     orderAsc,
-				})
-			}
-			for _, size := range []string{"", nameSize0256, nameSize0512, nameSize1024} {
-				fields := fields
-				if size != "" {
-					fields = append(fields, &field{
-						FieldPath: size,
-						Order:     orderAsc,
-					})
-				}
-				for _, order := range []string{nameID, nameUpdatedAt, namePublishedAt} {
-					if len(fields) == 0 {
-						continue
-					}
-					indexes = append(indexes,
-						&index{
-							CollectionGroup: collectionImage,
-							QueryScope:      queryScopeCollection,
-							Fields: append(fields, &field{
-								FieldPath: order,
-								Order:     orderAsc,
-							}),
-						},
-						&index{
-							CollectionGroup: collectionImage,
-							QueryScope:      queryScopeCollection,
-							Fields: append(fields, &field{
-								FieldPath: order,
-								Order:     orderDesc,
-							}),
-						},
-					)
-				}
-			}
-		}
+	flag.Parse()
+
+	data := &queryspec.IndexesData{
+		Indexes: queryspec.Image.Indexes(&queryspec.IndexOptions{
+			Merge: merge,
+		}),
+		FieldOverrides: queryspec.Image.FieldOverrides(),
 	}
-	fieldOverrides := []*fieldOverride{
-		&fieldOverride{
-			CollectionGroup: collectionImage,
-			FieldPath:       "Meta",
-			Indexes:         []interface{}{},
-		},
-		&fieldOverride{
-			CollectionGroup: collectionImage,
-			FieldPath:       "Parts",
-			Indexes:         []interface{}{},
-		},
+	log.Printf("%d indexes (budget: %d), %d fieldOverrides", len(data.Indexes), budget, len(data.FieldOverrides))
+	if len(data.Indexes) > budget {
+		log.Fatalf("number of indexes exceeds the budget by %d", len(data.Indexes)-budget)
 	}
-	data := &indexesData{
-		Indexes:        indexes,
-		FieldOverrides: fieldOverrides,
+	if check != "" {
+		ok, err := diff(check, data)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if !ok {
+			os.Exit(1)
+		}
+		log.Printf("%s is up to date", check)
+		return
 	}
+
 	out, err := json.MarshalIndent(data, "", "  ")
 	if err != nil {
 		log.Fatal(err)
 	}
 	fmt.Fprintln(os.Stdout, string(out))
+}
+
+// diff reports missing and stale entries of the existing file
+func diff(filename string, expected *queryspec.IndexesData) (bool, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return false, err
+	}
+	defer file.Close()
+	var existing queryspec.IndexesData
+	if err := json.NewDecoder(file).Decode(&existing); err != nil {
+		return false, err
+	}
+
+	ok := true
+	for _, key := range subtract(indexKeys(expected), indexKeys(&existing)) {
+		log.Printf("missing index: %s", key)
+		ok = false
+	}
+	for _, key := range subtract(indexKeys(&existing), indexKeys(expected)) {
+		log.Printf("stale index: %s", key)
+		ok = false
+	}
+	for _, key := range subtract(fieldOverrideKeys(expected), fieldOverrideKeys(&existing)) {
+		log.Printf("missing fieldOverride: %s", key)
+		ok = false
+	}
+	for _, key := range subtract(fieldOverrideKeys(&existing), fieldOverrideKeys(expected)) {
+		log.Printf("stale fieldOverride: %s", key)
+		ok = false
+	}
+	return ok, nil
+}
 
-	log.Printf("%d indexes, %d fieldOverrides", len(indexes), len(fieldOverrides))
+func indexKeys(data *queryspec.IndexesData) []string {
+	keys := []string{}
+	for _, index := range data.Indexes {
+		keys = append(keys, index.Key())
+	}
+	return keys
+}
+
+func fieldOverrideKeys(data *queryspec.IndexesData) []string {
+	keys := []string{}
+	for _, fieldOverride := range data.FieldOverrides {
+		keys = append(keys, fmt.Sprintf("%s.%s", fieldOverride.CollectionGroup, fieldOverride.FieldPath))
+	}
+	return keys
+}
+
+// subtract returns keys of a which are not in b
+func subtract(a, b []string) []string {
+	exists := map[string]bool{}
+	for _, key := range b {
+		exists[key] = true
+	}
+	results := []string{}
+	for _, key := range a {
+		if !exists[key] {
+			results = append(results, key)
+		}
+	}
+	return results
 }
@@ -0,0 +1,228 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"cloud.google.com/go/firestore"
+	"github.com/sugyan/image-dataset/web/entity"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+var (
+	projectID    string
+	resultsFile  string
+	labelsFile   string
+	modelVersion string
+)
+
+func init() {
+	flag.StringVar(&projectID, "projectID", "", "project ID")
+	flag.StringVar(&resultsFile, "results", "results.tsv", "path to prediction results")
+	flag.StringVar(&labelsFile, "labels", "", "path to labels file")
+	flag.StringVar(&modelVersion, "model", "", "model version")
+}
+
+type prediction struct {
+	id         string
+	class      string
+	confidence float64
+	margin     float64
+}
+
+func main() {
+	flag.Parse()
+	if projectID == "" || labelsFile == "" || modelVersion == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+	if err := run(context.Background()); err != nil {
+		log.Fatal(err)
+	}
+	log.Println("finish")
+}
+
+func run(ctx context.Context) error {
+	labels, err := loadLabels(labelsFile)
+	if err != nil {
+		return err
+	}
+	predictions, err := loadPredictions(resultsFile, labels)
+	if err != nil {
+		return err
+	}
+	fsClient, err := firestore.NewClient(ctx, projectID)
+	if err != nil {
+		return err
+	}
+	defer fsClient.Close()
+
+	for i, p := range predictions {
+		if err := store(ctx, fsClient, p); err != nil {
+			if status.Code(err) == codes.NotFound {
+				log.Printf("image %s not found", p.id)
+				continue
+			}
+			return err
+		}
+		if (i+1)%1000 == 0 {
+			log.Printf("%d...", i+1)
+		}
+	}
+	return nil
+}
+
+func loadLabels(filename string) ([]string, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	labels := []string{}
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		labels = append(labels, strings.TrimSpace(scanner.Text()))
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return labels, nil
+}
+
+// loadPredictions reads rows of `path, label, result, confidence[, probabilities]` written by predict.py.
+// Probabilities are required for more than two classes to calculate margins.
+// Image IDs are taken from the file names written by dump_data.
+func loadPredictions(filename string, labels []string) ([]*prediction, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	predictions := []*prediction{}
+	r := csv.NewReader(file)
+	r.Comma = '\t'
+	r.FieldsPerRecord = -1
+	for {
+		row, err := r.Read()
+		if err != nil {
+			if err == io.EOF {
+				break
+			}
+			return nil, err
+		}
+		if len(row) < 4 {
+			return nil, fmt.Errorf("invalid row: %v", row)
+		}
+		result, err := strconv.Atoi(row[2])
+		if err != nil {
+			return nil, err
+		}
+		if result < 0 || result >= len(labels) {
+			return nil, fmt.Errorf("invalid class index: %d", result)
+		}
+		confidence, err := strconv.ParseFloat(row[3], 64)
+		if err != nil {
+			return nil, err
+		}
+		// margin between the top two probabilities
+		var margin float64
+		switch {
+		case len(row) > 4:
+			probs := []float64{}
+			for _, s := range strings.Split(row[4], ",") {
+				prob, err := strconv.ParseFloat(s, 64)
+				if err != nil {
+					return nil, err
+				}
+				probs = append(probs, prob)
+			}
+			if len(probs) != len(labels) {
+				return nil, fmt.Errorf("invalid probabilities: %v", row)
+			}
+			margin = calcMargin(probs)
+		case len(labels) == 2:
+			// the other probability is 1 - confidence
+			margin = 2*confidence - 1
+		default:
+			return nil, fmt.Errorf("probabilities are required for %d classes: %v", len(labels), row)
+		}
+		predictions = append(predictions, &prediction{
+			id:         strings.TrimSuffix(filepath.Base(row[0]), filepath.Ext(row[0])),
+			class:      labels[result],
+			confidence: confidence,
+			margin:     margin,
+		})
+	}
+	return predictions, nil
+}
+
+func calcMargin(probs []float64) float64 {
+	first, second := 0.0, 0.0
+	for _, prob := range probs {
+		if prob > first {
+			first, second = prob, first
+		} else if prob > second {
+			second = prob
+		}
+	}
+	return first - second
+}
+
+func store(ctx context.Context, fsClient *firestore.Client, p *prediction) error {
+	return fsClient.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		docRef := fsClient.Collection(entity.KindNameImage).Doc(p.id)
+		document, err := tx.Get(docRef)
+		if err != nil {
+			return err
+		}
+		var image entity.Image
+		if err := document.DataTo(&image); err != nil {
+			return err
+		}
+		updates := []firestore.Update{
+			{Path: "PredictedClass", Value: p.class},
+			{Path: "Confidence", Value: p.confidence},
+			{Path: "Margin", Value: p.margin},
+			{Path: "ModelVersion", Value: modelVersion},
+		}
+		if image.Status == entity.StatusReady {
+			// Update counts
+			for i, b := range []bool{image.Size0256, image.Size0512, image.Size1024} {
+				if b {
+					docID := []string{"0256", "0512", "1024"}[i]
+					ref := fsClient.Collection(entity.KindNameCount).Doc(docID)
+					if err := tx.Update(ref, []firestore.Update{
+						{Path: entity.StatusReady.Path(), Value: firestore.Increment(-1)},
+						{Path: entity.StatusPredicted.Path(), Value: firestore.Increment(1)},
+					}); err != nil {
+						return err
+					}
+				}
+			}
+			if image.LabelName != "" {
+				ref := fsClient.Collection(entity.KindNameLabel).Doc(entity.LabelDocID(image.LabelName))
+				if err := tx.Set(ref, map[string]interface{}{
+					"Name":                        image.LabelName,
+					entity.StatusReady.Path():     firestore.Increment(-1),
+					entity.StatusPredicted.Path(): firestore.Increment(1),
+				}, firestore.MergeAll); err != nil {
+					return err
+				}
+			}
+			updates = append(updates, firestore.Update{Path: "Status", Value: entity.StatusPredicted})
+		}
+		return tx.Update(docRef, updates)
+	})
+}
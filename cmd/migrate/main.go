@@ -0,0 +1,209 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"cloud.google.com/go/storage"
+	"github.com/sugyan/image-dataset/web/entity"
+	"google.golang.org/api/iterator"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// number of documents per page, within the limit of a batched write
+const pageSize = 500
+
+func main() {
+	projectID := flag.String("projectID", "", "project ID")
+	dryRun := flag.Bool("dry-run", false, "report documents to be migrated without writing")
+	concurrency := flag.Int("concurrency", 10, "number of documents migrated concurrently")
+	flag.Parse()
+	if *projectID == "" || *concurrency < 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	if latest := migrations[len(migrations)-1].version; latest != entity.SchemaVersion {
+		log.Fatalf("latest migration %d does not match entity.SchemaVersion %d", latest, entity.SchemaVersion)
+	}
+	m := &migrator{
+		dryRun:      *dryRun,
+		concurrency: *concurrency,
+	}
+	if err := m.run(context.Background(), *projectID); err != nil {
+		log.Fatal(err)
+	}
+	log.Println("finish")
+}
+
+type migrator struct {
+	fsClient    *firestore.Client
+	env         *env
+	dryRun      bool
+	concurrency int
+}
+
+func (m *migrator) run(ctx context.Context, projectID string) error {
+	fsClient, err := firestore.NewClient(ctx, projectID)
+	if err != nil {
+		return err
+	}
+	defer fsClient.Close()
+	csClient, err := storage.NewClient(ctx)
+	if err != nil {
+		return err
+	}
+	defer csClient.Close()
+	bucketName := projectID + ".appspot.com"
+	if os.Getenv("DEVELOPMENT") != "" {
+		bucketName = "staging." + bucketName
+	}
+	m.fsClient = fsClient
+	m.env = &env{bucket: csClient.Bucket(bucketName)}
+
+	metaRef := fsClient.Collection(entity.KindNameMetadata).Doc(entity.DocNameMigrations)
+	applied := &entity.Migrations{}
+	document, err := metaRef.Get(ctx)
+	if err != nil {
+		if status.Code(err) != codes.NotFound {
+			return err
+		}
+	} else {
+		if err := document.DataTo(applied); err != nil {
+			return err
+		}
+	}
+	log.Printf("applied version: %d", applied.Version)
+
+	for _, migration := range migrations {
+		if migration.version <= applied.Version {
+			continue
+		}
+		log.Printf("migration %d: %s", migration.version, migration.description)
+		cursor := applied.Cursor
+		if cursor != "" {
+			log.Printf("resume after %s", cursor)
+		}
+		if err := m.migrate(ctx, migration, cursor, func(cursor string) error {
+			applied.Cursor = cursor
+			applied.UpdatedAt = time.Now()
+			_, err := metaRef.Set(ctx, applied)
+			return err
+		}); err != nil {
+			return err
+		}
+		if m.dryRun {
+			// later migrations read documents as written by this one
+			if migration.version < migrations[len(migrations)-1].version {
+				log.Printf("dry run stops at migration %d, later ones depend on it", migration.version)
+			}
+			return nil
+		}
+		applied.Version = migration.version
+		applied.Cursor = ""
+		applied.UpdatedAt = time.Now()
+		if _, err := metaRef.Set(ctx, applied); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// migrate applies migration to images after cursor, saving the cursor after each page
+func (m *migrator) migrate(ctx context.Context, migration *migration, cursor string, save func(string) error) error {
+	query := m.fsClient.Collection(entity.KindNameImage).
+		OrderBy("ID", firestore.Asc)
+	if cursor != "" {
+		query = query.StartAfter(cursor)
+	}
+	total, migrated, failed := 0, 0, 0
+	for {
+		documents := []*firestore.DocumentSnapshot{}
+		iter := query.Limit(pageSize).Documents(ctx)
+		for {
+			document, err := iter.Next()
+			if err != nil {
+				if errors.Is(err, iterator.Done) {
+					break
+				} else {
+					return err
+				}
+			}
+			query = query.StartAfter(document)
+			documents = append(documents, document)
+		}
+		if len(documents) == 0 {
+			break
+		}
+
+		targets := make([]bool, len(documents))
+		updates := make([][]firestore.Update, len(documents))
+		errs := make([]error, len(documents))
+		wg := sync.WaitGroup{}
+		sem := make(chan struct{}, m.concurrency)
+		for i, document := range documents {
+			if version, ok := document.Data()["SchemaVersion"].(int64); ok && int(version) >= migration.version {
+				continue
+			}
+			targets[i] = true
+			wg.Add(1)
+			sem <- struct{}{}
+			go func(i int, document *firestore.DocumentSnapshot) {
+				defer func() {
+					<-sem
+					wg.Done()
+				}()
+				updates[i], errs[i] = migration.apply(ctx, m.env, document)
+			}(i, document)
+		}
+		wg.Wait()
+
+		batch := m.fsClient.Batch()
+		n := 0
+		for i, document := range documents {
+			if !targets[i] {
+				continue
+			}
+			if errs[i] != nil {
+				// leave SchemaVersion as it is to tell it from migrated ones
+				log.Printf("failed to migrate %s: %s", document.Ref.ID, errs[i].Error())
+				failed++
+				continue
+			}
+			batch.Update(document.Ref, append(updates[i], firestore.Update{
+				Path: "SchemaVersion", Value: migration.version,
+			}))
+			n++
+		}
+		total += len(documents)
+		migrated += n
+		if !m.dryRun {
+			if n > 0 {
+				if _, err := batch.Commit(ctx); err != nil {
+					return err
+				}
+			}
+			if err := save(documents[len(documents)-1].Ref.ID); err != nil {
+				return err
+			}
+		}
+		log.Printf("%d... (migrated: %d, failed: %d)", total, migrated, failed)
+	}
+	if failed > 0 {
+		// scan from the beginning next time, failed documents are found by their SchemaVersion
+		if !m.dryRun {
+			if err := save(""); err != nil {
+				return err
+			}
+		}
+		return fmt.Errorf("migration %d: failed to migrate %d documents", migration.version, failed)
+	}
+	return nil
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+
+	"cloud.google.com/go/firestore"
+	"cloud.google.com/go/storage"
+	"github.com/sugyan/image-dataset/web/entity"
+	"github.com/sugyan/image-dataset/web/geometry"
+	"github.com/sugyan/image-dataset/web/quality"
+)
+
+// migration returns updates of an Image document, or nil if nothing to do.
+// It must be idempotent: documents may be migrated again after an interruption.
+type migration struct {
+	version     int
+	description string
+	apply       func(ctx context.Context, env *env, document *firestore.DocumentSnapshot) ([]firestore.Update, error)
+}
+
+// env is the resources available to migrations
+type env struct {
+	bucket *storage.BucketHandle
+}
+
+// migrations in order of version, append new ones and bump entity.SchemaVersion
+var migrations = []*migration{
+	{
+		version:     1,
+		description: "convert Meta stored as JSON bytes to a map",
+		apply:       migrateMeta,
+	},
+	{
+		version:     2,
+		description: "compute Geometry from landmarks",
+		apply:       migrateGeometry,
+	},
+	{
+		version:     3,
+		description: "compute Quality from stored images",
+		apply:       migrateQuality,
+	},
+	{
+		version:     4,
+		description: "remove JPEGQuality estimated from re-encoded faces",
+		apply:       migrateJPEGQuality,
+	},
+}
+
+func migrateMeta(ctx context.Context, env *env, document *firestore.DocumentSnapshot) ([]firestore.Update, error) {
+	data, ok := document.Data()["Meta"].([]byte)
+	if !ok {
+		return nil, nil
+	}
+	var old struct {
+		Angle   float64 `json:"angle"`
+		PhotoID int64   `json:"photo_id"`
+		LabelID int64   `json:"label_id"`
+	}
+	if err := json.Unmarshal(data, &old); err != nil {
+		return nil, fmt.Errorf("invalid meta: %w", err)
+	}
+	return []firestore.Update{
+		{Path: "Meta", Value: &entity.Meta{
+			Angle:   old.Angle,
+			PhotoID: old.PhotoID,
+			LabelID: old.LabelID,
+		}},
+	}, nil
+}
+
+func migrateGeometry(ctx context.Context, env *env, document *firestore.DocumentSnapshot) ([]firestore.Update, error) {
+	var image entity.Image
+	if err := document.DataTo(&image); err != nil {
+		return nil, err
+	}
+	if image.Geometry != nil {
+		return nil, nil
+	}
+	geo, err := geometry.Calculate(image.Landmarks(), image.Size)
+	if err != nil {
+		return nil, err
+	}
+	return []firestore.Update{
+		{Path: "Geometry", Value: geo},
+	}, nil
+}
+
+func migrateQuality(ctx context.Context, env *env, document *firestore.DocumentSnapshot) ([]firestore.Update, error) {
+	var image entity.Image
+	if err := document.DataTo(&image); err != nil {
+		return nil, err
+	}
+	if image.Quality != nil {
+		return nil, nil
+	}
+	r, err := env.bucket.Object(fmt.Sprintf("images/%s", image.ID)).NewReader(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	q, err := quality.Calculate(data)
+	if err != nil {
+		return nil, err
+	}
+	return []firestore.Update{
+		{Path: "Quality", Value: q},
+	}, nil
+}
+
+// migrateJPEGQuality removes JPEGQuality calculated from stored faces by an earlier migrateQuality,
+// which are always re-encoded by the detector. Sources of uploaded images are not available here.
+func migrateJPEGQuality(ctx context.Context, env *env, document *firestore.DocumentSnapshot) ([]firestore.Update, error) {
+	if _, err := document.DataAt("Quality.JPEGQuality"); err != nil {
+		return nil, nil
+	}
+	return []firestore.Update{
+		{Path: "Quality.JPEGQuality", Value: firestore.Delete},
+	}, nil
+}
@@ -0,0 +1,211 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"cloud.google.com/go/storage"
+	"github.com/sugyan/image-dataset/web/entity"
+	"github.com/sugyan/image-dataset/web/purge"
+	"google.golang.org/api/iterator"
+)
+
+// number of images purged in a transaction, within the limit of writes
+const chunkSize = 200
+
+var (
+	projectID string
+	retention time.Duration
+	dryRun    bool
+)
+
+func init() {
+	flag.StringVar(&projectID, "projectID", "", "project ID")
+	flag.DurationVar(&retention, "retention", 30*24*time.Hour, "period to keep images in the trash")
+	flag.BoolVar(&dryRun, "dry-run", false, "list images to be purged without deleting")
+}
+
+func main() {
+	flag.Parse()
+	if projectID == "" || retention < 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	failed, err := run(context.Background())
+	if err != nil {
+		log.Fatal(err)
+	}
+	if len(failed) > 0 {
+		log.Printf("failed to delete %d objects from storage:", len(failed))
+		for _, name := range failed {
+			log.Printf("  %s", name)
+		}
+		os.Exit(1)
+	}
+	log.Println("finish")
+}
+
+// run permanently deletes images in the trash for longer than the retention period,
+// and returns names of storage objects failed to delete
+func run(ctx context.Context) ([]string, error) {
+	fsClient, err := firestore.NewClient(ctx, projectID)
+	if err != nil {
+		return nil, err
+	}
+	defer fsClient.Close()
+	csClient, err := storage.NewClient(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer csClient.Close()
+	bucketName := projectID + ".appspot.com"
+	if os.Getenv("DEVELOPMENT") != "" {
+		bucketName = "staging." + bucketName
+	}
+
+	deadline := time.Now().Add(-retention)
+	log.Printf("purge images deleted before %s", deadline.Format(time.RFC3339))
+	images := []*entity.Image{}
+	query := fsClient.Collection(entity.KindNameImage).
+		Where("Status", "==", entity.StatusDeleted).
+		OrderBy("ID", firestore.Asc)
+	for {
+		n := 0
+		iter := query.Limit(500).Documents(ctx)
+		for {
+			document, err := iter.Next()
+			if err != nil {
+				if errors.Is(err, iterator.Done) {
+					break
+				} else {
+					return nil, err
+				}
+			}
+			query = query.StartAfter(document)
+			n++
+
+			var image entity.Image
+			if err := document.DataTo(&image); err != nil {
+				return nil, err
+			}
+			if image.DeletedAt.Before(deadline) {
+				images = append(images, &image)
+			}
+		}
+		if n == 0 {
+			break
+		}
+	}
+	for _, image := range images {
+		log.Printf("image %s: (deleted at: %s, label: %s)", image.ID, image.DeletedAt.Format(time.RFC3339), image.LabelName)
+	}
+	log.Printf("%d images to purge", len(images))
+	if dryRun {
+		return nil, nil
+	}
+
+	failed := []string{}
+	bucket := csClient.Bucket(bucketName)
+	for i := 0; i < len(images); i += chunkSize {
+		end := i + chunkSize
+		if end > len(images) {
+			end = len(images)
+		}
+		purged, err := purgeImages(ctx, fsClient, images[i:end], deadline)
+		if err != nil {
+			return nil, err
+		}
+		for _, image := range purged {
+			name := fmt.Sprintf("images/%s", image.ID)
+			if err := bucket.Object(name).Delete(ctx); err != nil && !errors.Is(err, storage.ErrObjectNotExist) {
+				log.Printf("failed to delete object %s: %s", name, err.Error())
+				failed = append(failed, name)
+			}
+		}
+		log.Printf("purged %d/%d images", end, len(images))
+	}
+	return failed, nil
+}
+
+// purgeImages deletes images which are still in the trash with their votes and comments,
+// and returns the images which have been deleted
+func purgeImages(ctx context.Context, fsClient *firestore.Client, images []*entity.Image, deadline time.Time) ([]*entity.Image, error) {
+	purged := []*entity.Image{}
+	err := fsClient.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		purged = []*entity.Image{}
+		refs := []*firestore.DocumentRef{}
+		for _, image := range images {
+			refs = append(refs, fsClient.Collection(entity.KindNameImage).Doc(image.ID))
+		}
+		documents, err := tx.GetAll(refs)
+		if err != nil {
+			return err
+		}
+		// the image may be restored after listing
+		counts := []int{0, 0, 0}
+		labels := map[string]int{}
+		for _, document := range documents {
+			if !document.Exists() {
+				continue
+			}
+			var image entity.Image
+			if err := document.DataTo(&image); err != nil {
+				return err
+			}
+			if image.Status != entity.StatusDeleted || !image.DeletedAt.Before(deadline) {
+				continue
+			}
+			for i, b := range []bool{image.Size0256, image.Size0512, image.Size1024} {
+				if b {
+					counts[i]++
+				}
+			}
+			if image.LabelName != "" {
+				labels[image.LabelName]++
+			}
+			purged = append(purged, &image)
+		}
+		for _, image := range purged {
+			if err := tx.Delete(fsClient.Collection(entity.KindNameImage).Doc(image.ID)); err != nil {
+				return err
+			}
+		}
+		for i, n := range counts {
+			if n > 0 {
+				docID := []string{"0256", "0512", "1024"}[i]
+				ref := fsClient.Collection(entity.KindNameCount).Doc(docID)
+				if err := tx.Update(ref, []firestore.Update{
+					{Path: entity.StatusDeleted.Path(), Value: firestore.Increment(-n)},
+				}); err != nil {
+					return err
+				}
+			}
+		}
+		for labelName, n := range labels {
+			ref := fsClient.Collection(entity.KindNameLabel).Doc(entity.LabelDocID(labelName))
+			if err := tx.Set(ref, map[string]interface{}{
+				"Name":                      labelName,
+				entity.StatusDeleted.Path(): firestore.Increment(-n),
+			}, firestore.MergeAll); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	// subcollections are not deleted with the parent document
+	for _, image := range purged {
+		if err := purge.DeleteSubcollections(ctx, fsClient, image.ID); err != nil {
+			return nil, err
+		}
+	}
+	return purged, nil
+}
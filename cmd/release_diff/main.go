@@ -0,0 +1,66 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"cloud.google.com/go/firestore"
+	"github.com/sugyan/image-dataset/web/release"
+)
+
+func main() {
+	projectID := flag.String("projectID", "", "project ID")
+	from := flag.String("a", "", "name of the base release")
+	to := flag.String("b", "", "name of the release to compare")
+	csv := flag.Bool("csv", false, "write changed images as CSV instead of the summary")
+	flag.Parse()
+	if *projectID == "" || *from == "" || *to == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+	if err := run(context.Background(), *projectID, *from, *to, *csv); err != nil {
+		log.Fatal(err)
+	}
+}
+
+func run(ctx context.Context, projectID, a, b string, csv bool) error {
+	fsClient, err := firestore.NewClient(ctx, projectID)
+	if err != nil {
+		return err
+	}
+	defer fsClient.Close()
+
+	relA, from, err := release.Get(ctx, fsClient, a)
+	if err != nil {
+		return err
+	}
+	relB, to, err := release.Get(ctx, fsClient, b)
+	if err != nil {
+		return err
+	}
+	diff := release.Compare(from, to)
+	if csv {
+		return diff.WriteCSV(os.Stdout)
+	}
+
+	fmt.Printf("%s: %d images (%s)\n", relA.Name, relA.Count, relA.Checksum)
+	fmt.Printf("%s: %d images (%s)\n", relB.Name, relB.Count, relB.Checksum)
+	counts := map[string]int{}
+	for _, change := range diff.Changes {
+		counts[change.Kind]++
+	}
+	fmt.Printf("\nadded: %d, removed: %d, relabeled: %d, status: %d, landmarks: %d\n",
+		counts[release.ChangeAdded], counts[release.ChangeRemoved], counts[release.ChangeRelabeled], counts[release.ChangeStatus], counts[release.ChangeLandmarks])
+	fmt.Printf("\n%-30s %8s %8s %8s %8s %8s %9s\n", "label", "added", "removed", "from", "to", "status", "landmarks")
+	for _, label := range diff.Labels {
+		fmt.Printf("%-30s %8d %8d %8d %8d %8d %9d\n", label.LabelName, label.Added, label.Removed, label.RelabeledFrom, label.RelabeledTo, label.StatusChanged, label.LandmarksChanged)
+	}
+	fmt.Printf("\n%-30s %8s\n", "status", "count")
+	for _, transition := range diff.Transitions {
+		fmt.Printf("%-30s %8d\n", transition.String(), transition.Count)
+	}
+	return nil
+}
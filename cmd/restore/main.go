@@ -0,0 +1,251 @@
+package main
+
+import (
+	"archive/tar"
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"cloud.google.com/go/firestore"
+	"cloud.google.com/go/storage"
+	"github.com/sugyan/image-dataset/web/backup"
+	"github.com/sugyan/image-dataset/web/entity"
+)
+
+// number of documents per batched write
+const batchSize = 500
+
+var (
+	projectID    string
+	indir        string
+	bucketName   string
+	imagesDir    string
+	imageBaseURL string
+)
+
+func init() {
+	flag.StringVar(&projectID, "projectID", "", "target project ID (set FIRESTORE_EMULATOR_HOST to restore into the emulator)")
+	flag.StringVar(&indir, "indir", "backup", "path to backup directory")
+	flag.StringVar(&bucketName, "bucket", "", "target bucket of images (default: <projectID>.appspot.com)")
+	flag.StringVar(&imagesDir, "images_dir", "", "extract images to the local directory instead of the bucket")
+	flag.StringVar(&imageBaseURL, "image_base_url", "", "base URL of ImageURL (default: URL of `images/` in the target bucket)")
+}
+
+func main() {
+	flag.Parse()
+	if projectID == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+	if bucketName == "" {
+		bucketName = projectID + ".appspot.com"
+		if os.Getenv("DEVELOPMENT") != "" {
+			bucketName = "staging." + bucketName
+		}
+	}
+	if imageBaseURL == "" {
+		imageBaseURL = fmt.Sprintf("https://storage.googleapis.com/%s/images", bucketName)
+	}
+	if err := run(context.Background()); err != nil {
+		log.Fatal(err)
+	}
+	log.Println("finish")
+}
+
+func run(ctx context.Context) error {
+	checksums, err := verify()
+	if err != nil {
+		return err
+	}
+	fsClient, err := firestore.NewClient(ctx, projectID)
+	if err != nil {
+		return err
+	}
+	defer fsClient.Close()
+
+	for _, kind := range backup.Kinds {
+		filename := kind + backup.DocumentsExt
+		if _, ok := checksums[filename]; !ok {
+			log.Printf("%s: skipped (not in %s)", kind, backup.ChecksumsFile)
+			continue
+		}
+		n, err := restoreDocuments(ctx, fsClient, filepath.Join(indir, filename))
+		if err != nil {
+			return err
+		}
+		log.Printf("%s: %d documents", kind, n)
+	}
+	if _, ok := checksums[backup.ImagesFile]; ok {
+		n, err := restoreImages(ctx, filepath.Join(indir, backup.ImagesFile))
+		if err != nil {
+			return err
+		}
+		log.Printf("images: %d objects", n)
+	}
+	return nil
+}
+
+// verify checks files of the backup with their checksums, and returns them
+func verify() (map[string]string, error) {
+	file, err := os.Open(filepath.Join(indir, backup.ChecksumsFile))
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	checksums := map[string]string{}
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("invalid line of %s: %s", backup.ChecksumsFile, scanner.Text())
+		}
+		checksums[fields[1]] = fields[0]
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	for filename, expected := range checksums {
+		f, err := os.Open(filepath.Join(indir, filename))
+		if err != nil {
+			return nil, err
+		}
+		hash := sha256.New()
+		_, err = io.Copy(hash, f)
+		f.Close()
+		if err != nil {
+			return nil, err
+		}
+		if actual := hex.EncodeToString(hash.Sum(nil)); actual != expected {
+			return nil, fmt.Errorf("checksum mismatch of %s: %s", filename, actual)
+		}
+	}
+	return checksums, nil
+}
+
+func restoreDocuments(ctx context.Context, fsClient *firestore.Client, filename string) (int, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+
+	n := 0
+	batch, size := fsClient.Batch(), 0
+	decoder := json.NewDecoder(file)
+	for {
+		var record backup.Record
+		if err := decoder.Decode(&record); err != nil {
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			return n, err
+		}
+		e, err := backup.NewEntity(record.Kind())
+		if err != nil {
+			return n, err
+		}
+		if err := json.Unmarshal(record.Data, e); err != nil {
+			return n, fmt.Errorf("%s: %w", record.Path, err)
+		}
+		// images are served from the target bucket, while items of releases are
+		// restored as frozen to keep their checksums
+		if image, ok := e.(*entity.Image); ok {
+			image.ImageURL = fmt.Sprintf("%s/%s", strings.TrimSuffix(imageBaseURL, "/"), path.Base(record.Path))
+		}
+		batch.Set(fsClient.Doc(record.Path), e)
+		n++
+		size++
+		if size == batchSize {
+			if _, err := batch.Commit(ctx); err != nil {
+				return n, err
+			}
+			batch, size = fsClient.Batch(), 0
+		}
+	}
+	if size > 0 {
+		if _, err := batch.Commit(ctx); err != nil {
+			return n, err
+		}
+	}
+	return n, nil
+}
+
+func restoreImages(ctx context.Context, filename string) (int, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+
+	var bucket *storage.BucketHandle
+	if imagesDir == "" {
+		csClient, err := storage.NewClient(ctx)
+		if err != nil {
+			return 0, err
+		}
+		defer csClient.Close()
+		bucket = csClient.Bucket(bucketName)
+	}
+	n := 0
+	tr := tar.NewReader(file)
+	for {
+		header, err := tr.Next()
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			return n, err
+		}
+		if imagesDir != "" {
+			if err := extract(tr, filepath.Join(imagesDir, path.Base(header.Name))); err != nil {
+				return n, err
+			}
+		} else {
+			if err := upload(ctx, tr, bucket.Object(header.Name)); err != nil {
+				return n, err
+			}
+		}
+		n++
+		if n%1000 == 0 {
+			log.Printf("%d...", n)
+		}
+	}
+	return n, nil
+}
+
+func extract(r io.Reader, filename string) error {
+	if err := os.MkdirAll(filepath.Dir(filename), 0755); err != nil {
+		return err
+	}
+	file, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	if _, err := io.Copy(file, r); err != nil {
+		return err
+	}
+	return file.Close()
+}
+
+func upload(ctx context.Context, r io.Reader, obj *storage.ObjectHandle) error {
+	w := obj.NewWriter(ctx)
+	if _, err := io.Copy(w, r); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return obj.ACL().Set(ctx, storage.AllUsers, storage.RoleReader)
+}
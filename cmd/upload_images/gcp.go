@@ -1,12 +1,14 @@
 package main
 
 import (
+	"bytes"
 	"context"
 	"crypto/md5"
 	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"os"
 	"path"
 	"strconv"
@@ -16,6 +18,8 @@ import (
 	"cloud.google.com/go/firestore"
 	"cloud.google.com/go/storage"
 	"github.com/sugyan/image-dataset/web/entity"
+	"github.com/sugyan/image-dataset/web/geometry"
+	"github.com/sugyan/image-dataset/web/quality"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
 )
@@ -65,11 +69,15 @@ func (g *gcp) upload(filepath string) error {
 
 	// load image file
 	name := strings.TrimSuffix(path.Base(filepath), path.Ext(filepath))
-	imageFile, err := os.Open(path.Join(path.Dir(filepath), name+".jpg"))
+	imageData, err := ioutil.ReadFile(path.Join(path.Dir(filepath), name+".jpg"))
 	if err != nil {
 		return err
 	}
-	defer imageFile.Close()
+	q, err := quality.Calculate(imageData)
+	if err != nil {
+		return err
+	}
+	q.JPEGQuality = data.JPEGQuality
 
 	// calculate key name
 	hash := md5.New()
@@ -77,10 +85,10 @@ func (g *gcp) upload(filepath string) error {
 	keyName := hex.EncodeToString(hash.Sum(nil))
 
 	ctx := context.Background()
-	if err := g.writeCS(ctx, keyName, imageFile); err != nil {
+	if err := g.writeCS(ctx, keyName, bytes.NewReader(imageData)); err != nil {
 		return err
 	}
-	if err := g.writeFS(ctx, keyName, data); err != nil {
+	if err := g.writeFS(ctx, keyName, data, q); err != nil {
 		return err
 	}
 	return nil
@@ -102,27 +110,28 @@ func (g *gcp) writeCS(ctx context.Context, objectName string, image io.Reader) e
 	return nil
 }
 
-func (g *gcp) writeFS(ctx context.Context, keyName string, data *data) error {
-	publishedAt, err := time.Parse("2006-01-02T15:04:05", data.Meta.PublishedAt)
-	if err != nil {
-		return err
+func (g *gcp) writeFS(ctx context.Context, keyName string, data *data, q *quality.Quality) error {
+	// left unset if unknown, to be excluded from filters and sorts of `published_at`
+	publishedAt := time.Time{}
+	if data.Meta.PublishedAt != "" {
+		t, err := time.Parse("2006-01-02T15:04:05", data.Meta.PublishedAt)
+		if err != nil {
+			return err
+		}
+		publishedAt = t
 	}
 	parts := make([]int, 136)
 	for i := 0; i < 68; i++ {
 		parts[i*2], parts[i*2+1] = data.Parts[i][0], data.Parts[i][1]
 	}
-	metaData := map[string]interface{}{
-		"angle": data.Angle,
-	}
-	if photoID, err := strconv.Atoi(data.Meta.PhotoID); err == nil {
-		metaData["photo_id"] = photoID
+	meta := entity.Meta{
+		Angle: float64(data.Angle),
 	}
-	if labelID, err := strconv.Atoi(data.Meta.LabelID); err == nil {
-		metaData["label_id"] = labelID
+	if photoID, err := strconv.ParseInt(data.Meta.PhotoID, 10, 64); err == nil {
+		meta.PhotoID = photoID
 	}
-	meta, err := json.Marshal(&metaData)
-	if err != nil {
-		return err
+	if labelID, err := strconv.ParseInt(data.Meta.LabelID, 10, 64); err == nil {
+		meta.LabelID = labelID
 	}
 
 	return g.fsClient.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
@@ -147,6 +156,9 @@ func (g *gcp) writeFS(ctx context.Context, keyName string, data *data) error {
 						}
 					}
 				}
+				if err := g.updateLabel(tx, data.Meta.LabelName, image.Status, 1); err != nil {
+					return err
+				}
 			} else {
 				return err
 			}
@@ -154,6 +166,14 @@ func (g *gcp) writeFS(ctx context.Context, keyName string, data *data) error {
 			if err := document.DataTo(&image); err != nil {
 				return err
 			}
+			if image.LabelName != data.Meta.LabelName {
+				if err := g.updateLabel(tx, image.LabelName, image.Status, -1); err != nil {
+					return err
+				}
+				if err := g.updateLabel(tx, data.Meta.LabelName, image.Status, 1); err != nil {
+					return err
+				}
+			}
 		}
 		image.ID = keyName
 		image.ImageURL = fmt.Sprintf("https://storage.googleapis.com/%s/images/%s", g.bucketName, keyName)
@@ -168,6 +188,24 @@ func (g *gcp) writeFS(ctx context.Context, keyName string, data *data) error {
 		image.PublishedAt = publishedAt
 		image.UpdatedAt = time.Now()
 		image.Meta = meta
+		geo, err := geometry.Calculate(image.Landmarks(), image.Size)
+		if err != nil {
+			return err
+		}
+		image.Geometry = geo
+		image.Quality = q
+		image.SchemaVersion = entity.SchemaVersion
 		return tx.Set(docRef, &image)
 	})
 }
+
+func (g *gcp) updateLabel(tx *firestore.Transaction, labelName string, status entity.Status, n int) error {
+	if labelName == "" {
+		return nil
+	}
+	ref := g.fsClient.Collection(entity.KindNameLabel).Doc(entity.LabelDocID(labelName))
+	return tx.Set(ref, map[string]interface{}{
+		"Name":        labelName,
+		status.Path(): firestore.Increment(n),
+	}, firestore.MergeAll)
+}
@@ -12,4 +12,6 @@ type data struct {
 		LabelID     string `json:"label_id"`
 		LabelName   string `json:"label_name"`
 	} `json:"meta"`
+	// of the source photo, 0 if unknown
+	JPEGQuality int `json:"jpeg_quality"`
 }
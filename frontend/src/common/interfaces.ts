@@ -9,5 +9,5 @@ export interface ImageResponse {
     photo_url: string
     published_at: number
     updated_at: number
-    meta: string
+    meta: { [key: string]: number }
 }
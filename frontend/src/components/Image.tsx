@@ -27,7 +27,7 @@ const useStyles = makeStyles({
 
 const InfoTable: React.FC<ImageResponse> = (image: ImageResponse) => {
     const classes = useStyles();
-    const meta = Object.entries(JSON.parse(image.meta)).map((value, index) => {
+    const meta = Object.entries(image.meta).map((value, index) => {
         return (
           <Box key={index} fontFamily="Monospace" fontSize="body1.fontSize">{value[0]}: {value[1]}</Box>
         );
@@ -80,7 +80,7 @@ const InfoTable: React.FC<ImageResponse> = (image: ImageResponse) => {
           <TableRow>
             <TableCell component="th" scope="row">Published at</TableCell>
             <TableCell>
-              {new Date(image.published_at * 1000).toISOString()}
+              {image.published_at ? new Date(image.published_at * 1000).toISOString() : "-"}
             </TableCell>
           </TableRow>
           <TableRow>
@@ -184,6 +184,27 @@ const ImageViewer: React.FC = () => {
             console.error(res.status);
         }
     };
+    const trashImage = async (restore: boolean) => {
+        const res: Response = await fetch(`/api/image/${params.id}${restore ? "/restore" : ""}`, {
+            method: restore ? "POST" : "DELETE",
+        });
+        if (res.ok) {
+            if (current) {
+                if (restore) {
+                    // restored with the status before deleted
+                    const image: ImageResponse = await res.json();
+                    current.status = image.status;
+                    current.updated_at = image.updated_at;
+                } else {
+                    current.status = 5;
+                    current.updated_at = Math.floor(new Date().getTime() / 1000);
+                }
+            }
+            nextImage();
+        } else {
+            console.error(res.status);
+        }
+    };
     useEffect(() => {
         const fetchData = async (id: string, reverse: boolean = false): Promise<ImageResponse[]> => {
             const params: URLSearchParams = new URLSearchParams(location.search);
@@ -301,6 +322,9 @@ const ImageViewer: React.FC = () => {
                     <Box mx={1}>OK</Box>
                   </ToggleButton>
                 </ToggleButtonGroup>
+                <Button size="small" onClick={() => trashImage(current !== undefined && current.status === 5)}>
+                  {current && current.status === 5 ? "Restore" : "Delete"}
+                </Button>
               </Box>
               <Box>
                 <Button onClick={() => nextImage()}>
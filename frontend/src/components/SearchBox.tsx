@@ -131,6 +131,11 @@ const SearchBox: React.FC = () => {
                     = Predicted
                   </Box>
                 </MenuItem>
+                <MenuItem value={"5"}>
+                  <Box fontSize="body1.fontSize" fontFamily="Monospace">
+                    = Deleted
+                  </Box>
+                </MenuItem>
               </Select>
             </FormControl>
             <FormControl className={classes.formControl}>
@@ -27,6 +27,7 @@ const Stats: React.FC = () => {
             <TableCell>{v["status_pending"]}</TableCell>
             <TableCell>{v["status_ok"]}</TableCell>
             <TableCell>{v["status_predicted"]}</TableCell>
+            <TableCell>{v["status_deleted"]}</TableCell>
           </TableRow>
         );
     });
@@ -43,6 +44,7 @@ const Stats: React.FC = () => {
                 <TableCell>Pending</TableCell>
                 <TableCell>OK</TableCell>
                 <TableCell>Predicted</TableCell>
+                <TableCell>Deleted</TableCell>
               </TableRow>
             </TableHead>
             <TableBody>{rows}</TableBody>
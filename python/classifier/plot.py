@@ -13,6 +13,8 @@ y_pred = []
 with open('results.tsv', 'r') as fp:
     reader = csv.reader(fp, delimiter='\t')
     for row in reader:
+        if int(row[1]) < 0:
+            continue
         y_true.append(labels[int(row[1])])
         y_pred.append(labels[int(row[2])])
 
@@ -5,7 +5,7 @@ import tensorflow as tf
 from model import cnn, IMAGE_SIZE
 
 
-def predict(data_dir, weights_path, labels_file):
+def predict(target_dir, weights_path, labels_file):
     labels = []
     with open(labels_file, 'r') as fp:
         labels = [line.strip() for line in fp.readlines()]
@@ -23,28 +23,33 @@ def predict(data_dir, weights_path, labels_file):
 
     with open('results.tsv', 'w') as fp:
         writer = csv.writer(fp, delimiter='\t')
-        for root, dirs, files in os.walk(os.path.join(data_dir, 'validation')):
+        for root, dirs, files in os.walk(target_dir):
             if not files:
                 continue
             class_name = os.path.basename(root)
-            if class_name not in labels:
-                continue
-            label = labels.index(class_name)
+            # unlabeled images (e.g. dumped by dump_data) have label -1
+            label = labels.index(class_name) if class_name in labels else -1
             for filename in files:
+                if not filename.endswith('.jpg'):
+                    continue
                 image = tf.io.decode_jpeg(tf.io.gfile.GFile(os.path.join(root, filename), 'rb').read())
                 images = tf.expand_dims(tf.image.convert_image_dtype(image, dtype=tf.float32), axis=0)
-                result = int(model.predict(images).argmax())
+                probs = model.predict(images)[0]
+                result = int(probs.argmax())
                 writer.writerow([
                     os.path.abspath(os.path.join(root, filename)),
                     label,
-                    result
+                    result,
+                    float(probs[result]),
+                    ','.join(str(float(p)) for p in probs),
                 ])
 
 
 if __name__ == "__main__":
     parser = argparse.ArgumentParser()
     parser.add_argument('--data_dir', default=os.path.join(os.path.dirname(__file__), '..', '..', 'images'))
+    parser.add_argument('--target_dir')
     parser.add_argument('--weights_path', required=True)
     parser.add_argument('--labels_file', default=os.path.join(os.path.dirname(__file__), 'labels.txt'))
     args = parser.parse_args()
-    predict(args.data_dir, args.weights_path, args.labels_file)
+    predict(args.target_dir or os.path.join(args.data_dir, 'validation'), args.weights_path, args.labels_file)
@@ -0,0 +1,42 @@
+import argparse
+import base64
+import json
+import os
+import sys
+import cv2
+import numpy as np
+
+from detect import Detector
+
+
+# Detect faces of images requested by `cmd/create_data`, one JSON object per line of stdin and stdout
+def run(datafile):
+    detector = Detector(datafile)
+    for line in sys.stdin:
+        if not line.strip():
+            continue
+        request = json.loads(line)
+        response = {'id': request['id']}
+        try:
+            data = np.frombuffer(base64.b64decode(request['image']), dtype=np.uint8)
+            img = cv2.imdecode(data, cv2.IMREAD_COLOR)
+            if img is None:
+                raise ValueError('failed to decode image')
+            result = detector.detect(img)
+            if result is not None:
+                _, face = cv2.imencode('.jpg', result['image'], [cv2.IMWRITE_JPEG_QUALITY, 100])
+                response['face'] = base64.b64encode(face.tobytes()).decode()
+                response['parts'] = [[int(x), int(y)] for x, y in result['parts']]
+                response['angle'] = float(result['angle'])
+                response['size'] = int(result['size'])
+        except Exception as e:
+            response['error'] = str(e)
+        sys.stdout.write(json.dumps(response) + '\n')
+        sys.stdout.flush()
+
+
+if __name__ == "__main__":
+    parser = argparse.ArgumentParser()
+    parser.add_argument('--predictor', default=os.path.join(os.path.dirname(__file__), 'shape_predictor_68_face_landmarks.dat'))
+    args = parser.parse_args()
+    run(args.predictor)
@@ -0,0 +1,188 @@
+package app
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"sort"
+
+	"github.com/sugyan/image-dataset/web/entity"
+	"google.golang.org/api/iterator"
+)
+
+type pairAgreement struct {
+	Reviewers [2]string `json:"reviewers"`
+	Items     int       `json:"items"`
+	Kappa     float64   `json:"kappa"`
+}
+
+type labelAgreement struct {
+	Status int     `json:"status"`
+	Kappa  float64 `json:"kappa"`
+}
+
+type agreementResponse struct {
+	Items  int               `json:"items"`
+	Kappa  float64           `json:"kappa"`
+	Pairs  []*pairAgreement  `json:"pairs"`
+	Labels []*labelAgreement `json:"labels"`
+}
+
+func (app *App) agreementHandler(w http.ResponseWriter, r *http.Request) {
+	// image ID -> uid -> status
+	votes := map[string]map[string]entity.Status{}
+	iter := app.fsClient.CollectionGroup(entity.KindNameVote).Documents(r.Context())
+	for {
+		document, err := iter.Next()
+		if err != nil {
+			if errors.Is(err, iterator.Done) {
+				break
+			} else {
+				log.Printf("failed to fetch votes: %s", err.Error())
+				http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+				return
+			}
+		}
+		var vote entity.Vote
+		if err := document.DataTo(&vote); err != nil {
+			log.Printf("failed to retrieve vote from document: %s", err.Error())
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+		if _, ok := votes[vote.ImageID]; !ok {
+			votes[vote.ImageID] = map[string]entity.Status{}
+		}
+		votes[vote.ImageID][vote.UID] = vote.Status
+	}
+	result := fleissKappa(votes)
+	result.Pairs = cohenKappas(votes)
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(result); err != nil {
+		log.Printf("failed to encode agreement: %s", err.Error())
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+}
+
+// cohenKappas calculates Cohen's kappa for each pair of reviewers
+// using the images both of them voted on.
+func cohenKappas(votes map[string]map[string]entity.Status) []*pairAgreement {
+	type pair [2]string
+	// pair -> list of (status, status)
+	ratings := map[pair][][2]entity.Status{}
+	for _, v := range votes {
+		uids := []string{}
+		for uid := range v {
+			uids = append(uids, uid)
+		}
+		sort.Strings(uids)
+		for i := 0; i < len(uids); i++ {
+			for j := i + 1; j < len(uids); j++ {
+				p := pair{uids[i], uids[j]}
+				ratings[p] = append(ratings[p], [2]entity.Status{v[uids[i]], v[uids[j]]})
+			}
+		}
+	}
+	results := []*pairAgreement{}
+	for p, r := range ratings {
+		n := float64(len(r))
+		agree := 0.0
+		marginals := [2]map[entity.Status]float64{{}, {}}
+		for _, s := range r {
+			if s[0] == s[1] {
+				agree++
+			}
+			marginals[0][s[0]]++
+			marginals[1][s[1]]++
+		}
+		po, pe := agree/n, 0.0
+		for status, count := range marginals[0] {
+			pe += (count / n) * (marginals[1][status] / n)
+		}
+		results = append(results, &pairAgreement{
+			Reviewers: p,
+			Items:     len(r),
+			Kappa:     kappa(po, pe),
+		})
+	}
+	sort.Slice(results, func(i, j int) bool {
+		if results[i].Reviewers[0] != results[j].Reviewers[0] {
+			return results[i].Reviewers[0] < results[j].Reviewers[0]
+		}
+		return results[i].Reviewers[1] < results[j].Reviewers[1]
+	})
+	return results
+}
+
+// fleissKappa calculates Fleiss' kappa, overall and per status,
+// using the images which have two or more votes.
+// The number of votes may differ between images.
+func fleissKappa(votes map[string]map[string]entity.Status) *agreementResponse {
+	result := &agreementResponse{
+		Labels: []*labelAgreement{},
+	}
+	// per image counts of each status
+	counts := []map[entity.Status]float64{}
+	totals := map[entity.Status]float64{}
+	sumN, sumPairs, sumP := 0.0, 0.0, 0.0
+	for _, v := range votes {
+		if len(v) < 2 {
+			continue
+		}
+		c := map[entity.Status]float64{}
+		for _, status := range v {
+			c[status]++
+			totals[status]++
+		}
+		n := float64(len(v))
+		agree := 0.0
+		for _, nij := range c {
+			agree += nij * nij
+		}
+		sumP += (agree - n) / (n * (n - 1))
+		sumN += n
+		sumPairs += n * (n - 1)
+		counts = append(counts, c)
+	}
+	result.Items = len(counts)
+	if result.Items == 0 {
+		return result
+	}
+	po, pe := sumP/float64(result.Items), 0.0
+	statuses := []entity.Status{}
+	for status, total := range totals {
+		pj := total / sumN
+		pe += pj * pj
+		statuses = append(statuses, status)
+	}
+	result.Kappa = kappa(po, pe)
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i] < statuses[j] })
+	for _, status := range statuses {
+		pj := totals[status] / sumN
+		disagree := 0.0
+		for _, c := range counts {
+			n := 0.0
+			for _, nij := range c {
+				n += nij
+			}
+			disagree += c[status] * (n - c[status])
+		}
+		k := 1.0
+		if pj < 1.0 {
+			k = 1.0 - disagree/(sumPairs*pj*(1.0-pj))
+		}
+		result.Labels = append(result.Labels, &labelAgreement{
+			Status: int(status),
+			Kappa:  k,
+		})
+	}
+	return result
+}
+
+func kappa(po, pe float64) float64 {
+	if pe >= 1.0 {
+		return 1.0
+	}
+	return (po - pe) / (1.0 - pe)
+}
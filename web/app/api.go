@@ -7,12 +7,14 @@ import (
 	"fmt"
 	"log"
 	"net/http"
+	"net/url"
 	"strconv"
 	"time"
 
 	"cloud.google.com/go/firestore"
 	"github.com/gorilla/mux"
 	"github.com/sugyan/image-dataset/web/entity"
+	"github.com/sugyan/image-dataset/web/queryspec"
 	"google.golang.org/api/iterator"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
@@ -36,24 +38,18 @@ type query struct {
 
 const limit = 30
 
-var (
-	sizeMap = map[string]string{
-		"256":  "Size0256",
-		"512":  "Size0512",
-		"1024": "Size1024",
-	}
-	sortMap = map[string]string{
-		"id":           "ID",
-		"updated_at":   "UpdatedAt",
-		"published_at": "PublishedAt",
-	}
-)
+// errInvalidQuery is returned by makeQuery for queries which can not be served
+var errInvalidQuery = errors.New("invalid query")
 
 func (app *App) imagesHandler(w http.ResponseWriter, r *http.Request) {
 	images, err := app.fetchImages(r)
 	if err != nil {
 		log.Printf("failed to fetch data: %s", err.Error())
-		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		if errors.Is(err, errInvalidQuery) {
+			http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		} else {
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		}
 		return
 	}
 	w.Header().Set("Content-Type", "application/json")
@@ -74,45 +70,26 @@ func (app *App) updateImageHandler(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
 		return
 	}
+	if !isActive(data.Status) {
+		log.Printf("invalid status: %d", data.Status)
+		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return
+	}
 	if err := app.updateImage(r.Context(), vars["id"], data.Status); err != nil {
 		log.Printf("failed to update status: %s", err.Error())
-		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		if errors.Is(err, errImageDeleted) {
+			http.Error(w, http.StatusText(http.StatusConflict), http.StatusConflict)
+		} else {
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		}
 		return
 	}
 	w.WriteHeader(http.StatusNoContent)
 }
 
 func (app *App) statsHandler(w http.ResponseWriter, r *http.Request) {
-	results := []*countResponse{}
-	collection := app.fsClient.Collection(entity.KindNameCount)
-	if err := func() error {
-		docIDs := []string{"0256", "0512", "1024"}
-		for _, docID := range docIDs {
-			docRef := collection.Doc(docID)
-			doc, err := docRef.Get(r.Context())
-			var count entity.Count
-			if err != nil {
-				if status.Code(err) == codes.NotFound {
-					docRef.Set(r.Context(), &count)
-				} else {
-					return err
-				}
-			} else {
-				if err := doc.DataTo(&count); err != nil {
-					return err
-				}
-			}
-			results = append(results, &countResponse{
-				Size:      docID,
-				Ready:     count.Ready,
-				NG:        count.NG,
-				Pending:   count.Pending,
-				OK:        count.OK,
-				Predicted: count.Predicted,
-			})
-		}
-		return nil
-	}(); err != nil {
+	results, err := app.counts(r.Context())
+	if err != nil {
 		log.Printf("failed to load stats: %s", err.Error())
 		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
 		return
@@ -125,6 +102,117 @@ func (app *App) statsHandler(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// counts returns the counts of each size, creating missing ones
+func (app *App) counts(ctx context.Context) ([]*countResponse, error) {
+	results := []*countResponse{}
+	collection := app.fsClient.Collection(entity.KindNameCount)
+	docIDs := []string{"0256", "0512", "1024"}
+	for _, docID := range docIDs {
+		docRef := collection.Doc(docID)
+		doc, err := docRef.Get(ctx)
+		var count entity.Count
+		if err != nil {
+			if status.Code(err) == codes.NotFound {
+				docRef.Set(ctx, &count)
+			} else {
+				return nil, err
+			}
+		} else {
+			if err := doc.DataTo(&count); err != nil {
+				return nil, err
+			}
+		}
+		results = append(results, newCountResponse(docID, &count))
+	}
+	return results, nil
+}
+
+func newImageResponse(image *entity.Image) *imageResponse {
+	leasedUntil := int64(0)
+	if !image.LeasedUntil.IsZero() {
+		leasedUntil = image.LeasedUntil.Unix()
+	}
+	publishedAt := int64(0)
+	if !image.PublishedAt.IsZero() {
+		publishedAt = image.PublishedAt.Unix()
+	}
+	tags := image.Tags
+	if tags == nil {
+		tags = []string{}
+	}
+	var prediction *predictionResponse
+	if image.ModelVersion != "" {
+		prediction = &predictionResponse{
+			Class:        image.PredictedClass,
+			Confidence:   image.Confidence,
+			Margin:       image.Margin,
+			ModelVersion: image.ModelVersion,
+		}
+	}
+	var geometry *geometryResponse
+	if image.Geometry != nil {
+		geometry = &geometryResponse{
+			InterOcular: image.Geometry.InterOcular,
+			FaceWidth:   image.Geometry.FaceWidth,
+			Yaw:         image.Geometry.Yaw,
+			Pitch:       image.Geometry.Pitch,
+			Roll:        image.Geometry.Roll,
+		}
+	}
+	var quality *qualityResponse
+	if image.Quality != nil {
+		quality = &qualityResponse{
+			Sharpness:   image.Quality.Sharpness,
+			Brightness:  image.Quality.Brightness,
+			Contrast:    image.Quality.Contrast,
+			JPEGQuality: image.Quality.JPEGQuality,
+		}
+	}
+	return &imageResponse{
+		ID:          image.ID,
+		ImageURL:    image.ImageURL,
+		Size:        image.Size,
+		Status:      int(image.Status),
+		Parts:       image.Landmarks(),
+		Corrected:   image.PartsCorrected,
+		LabelName:   image.LabelName,
+		SourceURL:   image.SourceURL,
+		PhotoURL:    image.PhotoURL,
+		PublishedAt: publishedAt,
+		UpdatedAt:   image.UpdatedAt.Unix(),
+		UpdatedBy:   image.UpdatedBy,
+		LeasedBy:    image.LeasedBy,
+		LeasedUntil: leasedUntil,
+		Prediction:  prediction,
+		Tags:        tags,
+		HasComments: image.HasComments,
+		Meta: &metaResponse{
+			Angle:   image.Meta.Angle,
+			PhotoID: image.Meta.PhotoID,
+			LabelID: image.Meta.LabelID,
+		},
+		Geometry: geometry,
+		Quality:  quality,
+	}
+}
+
+func newCountResponse(size string, count *entity.Count) *countResponse {
+	tags := count.Tags
+	if tags == nil {
+		tags = map[string]int{}
+	}
+	return &countResponse{
+		Size:      size,
+		Ready:     count.Ready,
+		NG:        count.NG,
+		Pending:   count.Pending,
+		OK:        count.OK,
+		Predicted: count.Predicted,
+		Deleted:   count.Deleted,
+		Tags:      tags,
+	}
+}
+
 func (app *App) userinfoHandler(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 	client, err := app.firebase.Auth(ctx)
@@ -152,57 +240,120 @@ func (app *App) fetchImages(r *http.Request) ([]*imageResponse, error) {
 	if err != nil {
 		return nil, err
 	}
+	count, err := queryCount(r.URL.Query())
+	if err != nil {
+		return nil, err
+	}
+	// `-tag` filters can not be expressed in a query, so skip tagged images while fetching
+	excludes := r.URL.Query()["-tag"]
 	images := []*imageResponse{}
-	iter := query.Documents(r.Context())
 	for {
-		document, err := iter.Next()
-		if err != nil {
-			if errors.Is(err, iterator.Done) {
-				break
-			} else {
+		n := 0
+		iter := query.Documents(r.Context())
+		for {
+			document, err := iter.Next()
+			if err != nil {
+				if errors.Is(err, iterator.Done) {
+					break
+				} else {
+					return nil, err
+				}
+			}
+			*query = query.StartAfter(document)
+			n++
+
+			var image entity.Image
+			if err := document.DataTo(&image); err != nil {
 				return nil, err
 			}
+			if hasAnyTag(&image, excludes) || len(images) >= count {
+				continue
+			}
+			images = append(images, newImageResponse(&image))
 		}
-		var image entity.Image
-		if err := document.DataTo(&image); err != nil {
-			return nil, err
+		if len(excludes) == 0 || n < count || len(images) >= count {
+			break
 		}
-		images = append(images, &imageResponse{
-			ID:          image.ID,
-			ImageURL:    image.ImageURL,
-			Size:        image.Size,
-			Status:      int(image.Status),
-			Parts:       image.Parts,
-			LabelName:   image.LabelName,
-			SourceURL:   image.SourceURL,
-			PhotoURL:    image.PhotoURL,
-			PublishedAt: image.PublishedAt.Unix(),
-			UpdatedAt:   image.UpdatedAt.Unix(),
-			Meta:        string(image.Meta),
-		})
 	}
 	return images, nil
 }
 
+// isActive reports whether status can be set by reviewers
+func isActive(status entity.Status) bool {
+	for _, s := range entity.ActiveStatuses {
+		if s == status {
+			return true
+		}
+	}
+	return false
+}
+
+func queryCount(values url.Values) (int, error) {
+	if values.Get("count") != "" {
+		return strconv.Atoi(values.Get("count"))
+	}
+	return limit, nil
+}
+
+func hasAnyTag(image *entity.Image, tags []string) bool {
+	for _, tag := range tags {
+		if image.HasTag(tag) {
+			return true
+		}
+	}
+	return false
+}
+
+// geometryValue returns the value of the geometry field at path
+func geometryValue(image *entity.Image, path string) float64 {
+	switch path {
+	case queryspec.FieldInterOcular:
+		return image.Geometry.InterOcular
+	case queryspec.FieldFaceWidth:
+		return image.Geometry.FaceWidth
+	case queryspec.FieldYaw:
+		return image.Geometry.Yaw
+	case queryspec.FieldPitch:
+		return image.Geometry.Pitch
+	case queryspec.FieldRoll:
+		return image.Geometry.Roll
+	}
+	return 0
+}
+
+// qualityValue returns the value of the quality field at path
+func qualityValue(image *entity.Image, path string) interface{} {
+	switch path {
+	case queryspec.FieldSharpness:
+		return image.Quality.Sharpness
+	case queryspec.FieldBrightness:
+		return image.Quality.Brightness
+	case queryspec.FieldContrast:
+		return image.Quality.Contrast
+	case queryspec.FieldJPEGQuality:
+		return image.Quality.JPEGQuality
+	}
+	return nil
+}
+
 func (app *App) makeQuery(r *http.Request) (*firestore.Query, error) {
 	values := r.URL.Query()
 	collection := app.fsClient.Collection(entity.KindNameImage)
-	query := collection.Query
-	if values.Get("count") != "" {
-		count, err := strconv.Atoi(values.Get("count"))
-		if err != nil {
-			return nil, err
-		}
-		query = query.Limit(count)
-	} else {
-		query = query.Limit(limit)
+	count, err := queryCount(values)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", errInvalidQuery, err.Error())
 	}
+	query := collection.Query.Limit(count)
+	// field of inequality filters, which must be the first ordering
+	rangePath := ""
+	// filters to check the coverage of indexes
+	specFilters := []*queryspec.Filter{}
 	// `Where`
 	{
 		filters := []*queryFilter{}
 		if values.Get("name") != "" {
 			filters = append(filters, &queryFilter{
-				path:  "LabelName",
+				path:  queryspec.FieldLabelName,
 				op:    "==",
 				value: values.Get("name"),
 			})
@@ -210,33 +361,128 @@ func (app *App) makeQuery(r *http.Request) (*firestore.Query, error) {
 		if values.Get("status") != "" && values.Get("status") != "all" {
 			status, err := strconv.Atoi(values.Get("status"))
 			if err != nil {
-				return nil, err
+				return nil, fmt.Errorf("%w: %s", errInvalidQuery, err.Error())
 			}
 			filters = append(filters, &queryFilter{
-				path:  "Status",
+				path:  queryspec.FieldStatus,
 				op:    "==",
 				value: status,
 			})
+		} else {
+			// hide images in the trash
+			filters = append(filters, &queryFilter{
+				path:  queryspec.FieldStatus,
+				op:    "in",
+				value: entity.ActiveStatuses,
+			})
 		}
 		if values.Get("size") != "" && values.Get("size") != "all" {
-			if key, ok := sizeMap[values.Get("size")]; ok {
+			if key, ok := queryspec.Image.Sizes[values.Get("size")]; ok {
 				filters = append(filters, &queryFilter{
 					path:  key,
 					op:    "==",
 					value: true,
 				})
 			} else {
-				return nil, fmt.Errorf("invalid size query: %v", values.Get("size"))
+				return nil, fmt.Errorf("%w: size=%v", errInvalidQuery, values.Get("size"))
+			}
+		}
+		ranges := []*queryFilter{}
+		for key, path := range queryspec.Image.Ranges {
+			if values.Get(key+"_min") != "" {
+				v, err := strconv.ParseFloat(values.Get(key+"_min"), 64)
+				if err != nil {
+					return nil, fmt.Errorf("%w: %s", errInvalidQuery, err.Error())
+				}
+				ranges = append(ranges, &queryFilter{
+					path:  path,
+					op:    ">=",
+					value: v,
+				})
+			}
+			if values.Get(key+"_max") != "" {
+				v, err := strconv.ParseFloat(values.Get(key+"_max"), 64)
+				if err != nil {
+					return nil, fmt.Errorf("%w: %s", errInvalidQuery, err.Error())
+				}
+				ranges = append(ranges, &queryFilter{
+					path:  path,
+					op:    "<=",
+					value: v,
+				})
+			}
+		}
+		for key, path := range queryspec.Image.DateRanges {
+			if values.Get(key+"_after") != "" {
+				t, err := queryspec.ParseTime(values.Get(key + "_after"))
+				if err != nil {
+					return nil, fmt.Errorf("%w: %s", errInvalidQuery, err.Error())
+				}
+				ranges = append(ranges, &queryFilter{
+					path:  path,
+					op:    ">=",
+					value: t,
+				})
+			}
+			if values.Get(key+"_before") != "" {
+				t, err := queryspec.ParseTime(values.Get(key + "_before"))
+				if err != nil {
+					return nil, fmt.Errorf("%w: %s", errInvalidQuery, err.Error())
+				}
+				ranges = append(ranges, &queryFilter{
+					path:  path,
+					op:    "<",
+					value: t,
+				})
 			}
 		}
+		// inequality filters are allowed on only one field
+		for _, filter := range ranges {
+			if rangePath != "" && rangePath != filter.path {
+				return nil, fmt.Errorf("%w: range filters on multiple fields: %s, %s", errInvalidQuery, rangePath, filter.path)
+			}
+			rangePath = filter.path
+		}
+		filters = append(filters, ranges...)
+		// images without comments may lack the field, so only `true` is supported
+		if values.Get("has_comments") == "true" {
+			filters = append(filters, &queryFilter{
+				path:  queryspec.FieldHasComments,
+				op:    "==",
+				value: true,
+			})
+		}
+		if values.Get("tag") != "" {
+			if !app.isTag(values.Get("tag")) {
+				return nil, fmt.Errorf("%w: tag=%v", errInvalidQuery, values.Get("tag"))
+			}
+			filters = append(filters, &queryFilter{
+				path:  queryspec.FieldTags,
+				op:    "array-contains",
+				value: values.Get("tag"),
+			})
+		}
 		for _, filter := range filters {
 			query = query.Where(filter.path, filter.op, filter.value)
+			switch filter.op {
+			case "==", "in":
+				specFilters = append(specFilters, &queryspec.Filter{Field: filter.path, Kind: queryspec.Equal})
+			case "array-contains":
+				specFilters = append(specFilters, &queryspec.Filter{Field: filter.path, Kind: queryspec.ArrayContains})
+			}
 		}
 	}
 	// `Order`
 	{
 		if values.Get("sort") != "" {
-			if path, ok := sortMap[values.Get("sort")]; ok {
+			if path, ok := queryspec.Image.Sorts[values.Get("sort")]; ok {
+				if rangePath != "" && rangePath != path {
+					return nil, fmt.Errorf("%w: sort=%v with range filter", errInvalidQuery, values.Get("sort"))
+				}
+				// images without predictions have zero margin, which would be listed first
+				if path == queryspec.FieldMargin && values.Get("status") != strconv.Itoa(int(entity.StatusPredicted)) {
+					return nil, fmt.Errorf("%w: sort=uncertainty requires status=%d", errInvalidQuery, entity.StatusPredicted)
+				}
 				reverse := values.Get("reverse") == "true"
 				if values.Get("order") == "desc" {
 					reverse = !reverse
@@ -258,12 +504,34 @@ func (app *App) makeQuery(r *http.Request) (*firestore.Query, error) {
 						return nil, err
 					}
 					switch path {
-					case "ID":
+					case queryspec.FieldID:
 						query = query.Where(path, op, image.ID)
-					case "PublishedAt":
+					case queryspec.FieldPublishedAt:
+						if image.PublishedAt.IsZero() {
+							return nil, fmt.Errorf("%w: no published time of %s", errInvalidQuery, image.ID)
+						}
 						query = query.Where(path, op, image.PublishedAt)
-					case "UpdatedAt":
+					case queryspec.FieldUpdatedAt:
 						query = query.Where(path, op, image.UpdatedAt)
+					case queryspec.FieldConfidence:
+						query = query.Where(path, op, image.Confidence)
+					case queryspec.FieldMargin:
+						query = query.Where(path, op, image.Margin)
+					case queryspec.FieldCreatedAt:
+						query = query.Where(path, op, image.CreatedAt)
+					case queryspec.FieldAngle:
+						query = query.Where(path, op, image.Meta.Angle)
+					case queryspec.FieldInterOcular, queryspec.FieldFaceWidth, queryspec.FieldYaw, queryspec.FieldPitch, queryspec.FieldRoll:
+						if image.Geometry == nil {
+							return nil, fmt.Errorf("%w: no geometry of %s", errInvalidQuery, image.ID)
+						}
+						query = query.Where(path, op, geometryValue(&image, path))
+					case queryspec.FieldSharpness, queryspec.FieldBrightness, queryspec.FieldContrast, queryspec.FieldJPEGQuality:
+						// JPEGQuality is omitted if unknown
+						if image.Quality == nil || (path == queryspec.FieldJPEGQuality && image.Quality.JPEGQuality == 0) {
+							return nil, fmt.Errorf("%w: no quality of %s", errInvalidQuery, image.ID)
+						}
+						query = query.Where(path, op, qualityValue(&image, path))
 					}
 				}
 				if reverse {
@@ -272,14 +540,23 @@ func (app *App) makeQuery(r *http.Request) (*firestore.Query, error) {
 					query = query.OrderBy(path, firestore.Asc)
 				}
 			} else {
-				return nil, fmt.Errorf("invalid sort query: %v", values.Get("sort"))
+				return nil, fmt.Errorf("%w: sort=%v", errInvalidQuery, values.Get("sort"))
 			}
 		}
 	}
+	// reject queries which would fail with missing indexes
+	order := rangePath
+	if values.Get("sort") != "" {
+		order = queryspec.Image.Sorts[values.Get("sort")]
+	}
+	if !queryspec.Image.Covers(specFilters, order) {
+		return nil, fmt.Errorf("%w: not indexed: %v", errInvalidQuery, values.Encode())
+	}
 	return &query, nil
 }
 
 func (app *App) updateImage(ctx context.Context, id string, status entity.Status) error {
+	uid := app.uid(ctx)
 	return app.fsClient.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
 		docRef := app.fsClient.Collection(entity.KindNameImage).Doc(id)
 		doc, err := tx.Get(docRef)
@@ -292,29 +569,98 @@ func (app *App) updateImage(ctx context.Context, id string, status entity.Status
 			log.Printf("failed to retrieve image from document: %s", err.Error())
 			return err
 		}
-		if image.Status != status {
-			// Update counts
-			for i, b := range []bool{image.Size0256, image.Size0512, image.Size1024} {
-				if b {
-					docID := []string{"0256", "0512", "1024"}[i]
-					ref := app.fsClient.Collection(entity.KindNameCount).Doc(docID)
-					if err := tx.Update(ref, []firestore.Update{
-						{Path: image.Status.Path(), Value: firestore.Increment(-1)},
-						{Path: status.Path(), Value: firestore.Increment(1)},
-					}); err != nil {
-						return err
-					}
-				}
-			}
-			// Update status
-			image.Status = entity.Status(status)
-			image.UpdatedAt = time.Now()
-			if err := tx.Set(docRef, &image); err != nil {
-				log.Printf("failed to set document: %s", err.Error())
+		if image.Status == entity.StatusDeleted {
+			return errImageDeleted
+		}
+		if app.consensus != nil {
+			decided, err := app.vote(tx, docRef, uid, status)
+			if err != nil {
 				return err
 			}
-
+			if decided == nil {
+				// Release lease only
+				if image.LeasedBy != uid {
+					return nil
+				}
+				return tx.Update(docRef, []firestore.Update{
+					{Path: "LeasedBy", Value: ""},
+					{Path: "LeasedUntil", Value: time.Time{}},
+				})
+			}
+			status = *decided
+		}
+		if image.Status != status {
+			return app.setStatus(tx, docRef, &image, status, uid)
 		}
 		return nil
 	})
 }
+
+func (app *App) setStatus(tx *firestore.Transaction, docRef *firestore.DocumentRef, image *entity.Image, status entity.Status, uid string) error {
+	// Update counts
+	for i, b := range []bool{image.Size0256, image.Size0512, image.Size1024} {
+		if b {
+			docID := []string{"0256", "0512", "1024"}[i]
+			ref := app.fsClient.Collection(entity.KindNameCount).Doc(docID)
+			if err := tx.Update(ref, []firestore.Update{
+				{Path: image.Status.Path(), Value: firestore.Increment(-1)},
+				{Path: status.Path(), Value: firestore.Increment(1)},
+			}); err != nil {
+				return err
+			}
+		}
+	}
+	// Update tag counts, which exclude images in the trash
+	if len(image.Tags) > 0 && (status == entity.StatusDeleted || image.Status == entity.StatusDeleted) {
+		n := 1
+		if status == entity.StatusDeleted {
+			n = -1
+		}
+		for i, b := range []bool{image.Size0256, image.Size0512, image.Size1024} {
+			if b {
+				updates := []firestore.Update{}
+				for _, tag := range image.Tags {
+					updates = append(updates, firestore.Update{
+						Path:  "Tags." + tag,
+						Value: firestore.Increment(n),
+					})
+				}
+				docID := []string{"0256", "0512", "1024"}[i]
+				ref := app.fsClient.Collection(entity.KindNameCount).Doc(docID)
+				if err := tx.Update(ref, updates); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	// Update label counts
+	if image.LabelName != "" {
+		ref := app.fsClient.Collection(entity.KindNameLabel).Doc(entity.LabelDocID(image.LabelName))
+		if err := tx.Set(ref, map[string]interface{}{
+			"Name":              image.LabelName,
+			image.Status.Path(): firestore.Increment(-1),
+			status.Path():       firestore.Increment(1),
+		}, firestore.MergeAll); err != nil {
+			return err
+		}
+	}
+	// Keep the status to restore
+	if status == entity.StatusDeleted {
+		image.PreviousStatus = image.Status
+		image.DeletedAt = time.Now()
+	} else {
+		image.DeletedAt = time.Time{}
+	}
+	// Update status
+	image.Status = status
+	image.UpdatedAt = time.Now()
+	image.UpdatedBy = uid
+	// Release lease
+	image.LeasedBy = ""
+	image.LeasedUntil = time.Time{}
+	if err := tx.Set(docRef, image); err != nil {
+		log.Printf("failed to set document: %s", err.Error())
+		return err
+	}
+	return nil
+}
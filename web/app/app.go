@@ -3,11 +3,14 @@ package app
 import (
 	"context"
 	"encoding/hex"
+	"fmt"
 	"html/template"
 	"log"
 	"net/http"
 	"os"
 	"path/filepath"
+	"strconv"
+	"time"
 
 	"cloud.google.com/go/firestore"
 	firebase "firebase.google.com/go"
@@ -15,7 +18,11 @@ import (
 	"github.com/gorilla/sessions"
 )
 
-const sessionUser = "user"
+const (
+	sessionUser         = "user"
+	defaultLeaseTTL     = 10 * time.Minute
+	defaultMaxListeners = 20
+)
 
 // App struct
 type App struct {
@@ -23,6 +30,11 @@ type App struct {
 	fsClient   *firestore.Client
 	session    sessions.Store
 	adminToken string
+	leaseTTL   time.Duration
+	consensus  *consensus
+	tags       []string
+	// semaphore of clients streaming `/api/events`, each holds snapshot listeners
+	listeners chan struct{}
 }
 
 // NewApp function
@@ -40,12 +52,44 @@ func NewApp(projectID string) (*App, error) {
 	if err != nil {
 		return nil, err
 	}
+	leaseTTL := defaultLeaseTTL
+	if os.Getenv("LEASE_TTL") != "" {
+		leaseTTL, err = time.ParseDuration(os.Getenv("LEASE_TTL"))
+		if err != nil {
+			return nil, err
+		}
+	}
+	var consensus *consensus
+	if os.Getenv("CONSENSUS") != "" {
+		consensus, err = parseConsensus(os.Getenv("CONSENSUS"))
+		if err != nil {
+			return nil, err
+		}
+	}
+	maxListeners := defaultMaxListeners
+	if os.Getenv("MAX_LISTENERS") != "" {
+		maxListeners, err = strconv.Atoi(os.Getenv("MAX_LISTENERS"))
+		if err != nil || maxListeners < 0 {
+			return nil, fmt.Errorf("invalid MAX_LISTENERS: %q", os.Getenv("MAX_LISTENERS"))
+		}
+	}
+	tags := defaultTags
+	if os.Getenv("TAGS") != "" {
+		tags, err = parseTags(os.Getenv("TAGS"))
+		if err != nil {
+			return nil, err
+		}
+	}
 
 	return &App{
 		firebase:   fbApp,
 		fsClient:   fsClient,
 		session:    sessions.NewCookieStore(sessionKey),
 		adminToken: os.Getenv("ADMIN_TOKEN"),
+		leaseTTL:   leaseTTL,
+		consensus:  consensus,
+		tags:       tags,
+		listeners:  make(chan struct{}, maxListeners),
 	}, nil
 }
 
@@ -58,7 +102,22 @@ func (app *App) Handler() http.Handler {
 	api := router.PathPrefix("/api").Subrouter()
 	api.HandleFunc("/images", app.imagesHandler).Methods("GET")
 	api.HandleFunc("/image/{id}", app.updateImageHandler).Methods("PUT")
+	api.HandleFunc("/image/{id}", app.deleteImageHandler).Methods("DELETE")
+	api.HandleFunc("/image/{id}/restore", app.restoreImageHandler).Methods("POST")
+	api.HandleFunc("/image/{id}/parts", app.updatePartsHandler).Methods("PUT")
+	api.HandleFunc("/image/{id}/comments", app.commentsHandler).Methods("GET")
+	api.HandleFunc("/image/{id}/comments", app.postCommentHandler).Methods("POST")
+	api.HandleFunc("/tags", app.tagsHandler).Methods("GET")
+	api.HandleFunc("/tags", app.updateTagsHandler).Methods("POST")
+	api.HandleFunc("/review/claim", app.claimHandler).Methods("POST")
+	api.HandleFunc("/agreement", app.agreementHandler).Methods("GET")
+	api.HandleFunc("/labels", app.labelsHandler).Methods("GET")
 	api.HandleFunc("/stats", app.statsHandler).Methods("GET")
+	api.HandleFunc("/releases", app.releasesHandler).Methods("GET")
+	api.HandleFunc("/releases", app.createReleaseHandler).Methods("POST")
+	api.HandleFunc("/releases/{name}", app.releaseHandler).Methods("GET")
+	api.HandleFunc("/releases/{a}/diff/{b}", app.releaseDiffHandler).Methods("GET")
+	api.HandleFunc("/events", app.eventsHandler).Methods("GET")
 	api.HandleFunc("/userinfo", app.userinfoHandler).Methods("GET")
 	api.Use(app.authMiddleware)
 
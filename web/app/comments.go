@@ -0,0 +1,119 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"github.com/gorilla/mux"
+	"github.com/sugyan/image-dataset/web/entity"
+	"google.golang.org/api/iterator"
+)
+
+func (app *App) commentsHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	comments, err := app.fetchComments(r.Context(), vars["id"])
+	if err != nil {
+		log.Printf("failed to fetch comments: %s", err.Error())
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(&comments); err != nil {
+		log.Printf("failed to encode comments: %s", err.Error())
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+}
+
+func (app *App) postCommentHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	var data struct {
+		Text string `json:"text"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&data); err != nil {
+		log.Printf("failed to decode json: %s", err.Error())
+		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return
+	}
+	if strings.TrimSpace(data.Text) == "" {
+		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return
+	}
+	comment, err := app.addComment(r.Context(), vars["id"], data.Text)
+	if err != nil {
+		log.Printf("failed to add comment: %s", err.Error())
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	if err := json.NewEncoder(w).Encode(comment); err != nil {
+		log.Printf("failed to encode comment: %s", err.Error())
+		return
+	}
+}
+
+func (app *App) fetchComments(ctx context.Context, id string) ([]*commentResponse, error) {
+	comments := []*commentResponse{}
+	iter := app.fsClient.Collection(entity.KindNameImage).Doc(id).
+		Collection(entity.KindNameComment).
+		OrderBy("CreatedAt", firestore.Asc).
+		Documents(ctx)
+	for {
+		document, err := iter.Next()
+		if err != nil {
+			if errors.Is(err, iterator.Done) {
+				break
+			} else {
+				return nil, err
+			}
+		}
+		var comment entity.Comment
+		if err := document.DataTo(&comment); err != nil {
+			return nil, err
+		}
+		comments = append(comments, newCommentResponse(document.Ref.ID, &comment))
+	}
+	return comments, nil
+}
+
+func (app *App) addComment(ctx context.Context, id, text string) (*commentResponse, error) {
+	comment := &entity.Comment{
+		ImageID:   id,
+		UID:       app.uid(ctx),
+		Text:      text,
+		CreatedAt: time.Now(),
+	}
+	docRef := app.fsClient.Collection(entity.KindNameImage).Doc(id)
+	commentRef := docRef.Collection(entity.KindNameComment).NewDoc()
+	if err := app.fsClient.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		// fail if the image does not exist
+		if _, err := tx.Get(docRef); err != nil {
+			return err
+		}
+		if err := tx.Create(commentRef, comment); err != nil {
+			return err
+		}
+		return tx.Update(docRef, []firestore.Update{
+			{Path: "HasComments", Value: true},
+		})
+	}); err != nil {
+		return nil, err
+	}
+	return newCommentResponse(commentRef.ID, comment), nil
+}
+
+func newCommentResponse(id string, comment *entity.Comment) *commentResponse {
+	return &commentResponse{
+		ID:        id,
+		UID:       comment.UID,
+		Text:      comment.Text,
+		CreatedAt: comment.CreatedAt.Unix(),
+	}
+}
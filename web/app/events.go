@@ -0,0 +1,218 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"github.com/sugyan/image-dataset/web/entity"
+)
+
+// interval of comment lines which keep idle streams open through proxies
+const heartbeatInterval = 30 * time.Second
+
+// max number of images returned by a poll of `/api/events`
+const pollLimit = 500
+
+type event struct {
+	name string
+	data interface{}
+}
+
+// eventsHandler streams events, or returns events after `since` if it is given,
+// for runtimes which buffer responses such as App Engine standard
+func (app *App) eventsHandler(w http.ResponseWriter, r *http.Request) {
+	if _, ok := r.URL.Query()["since"]; ok {
+		app.pollEvents(w, r)
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		log.Printf("streaming is not supported")
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	select {
+	case app.listeners <- struct{}{}:
+		defer func() { <-app.listeners }()
+	default:
+		w.Header().Set("Retry-After", strconv.Itoa(int(heartbeatInterval/time.Second)))
+		http.Error(w, http.StatusText(http.StatusServiceUnavailable), http.StatusServiceUnavailable)
+		return
+	}
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+
+	eventCh, errCh := make(chan *event), make(chan error, 2)
+	go app.watchImages(ctx, time.Now(), eventCh, errCh)
+	go app.watchCounts(ctx, eventCh, errCh)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+	ticker := time.NewTicker(heartbeatInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case err := <-errCh:
+			log.Printf("failed to watch events: %s", err.Error())
+			return
+		case <-ticker.C:
+			if _, err := fmt.Fprint(w, ": heartbeat\n\n"); err != nil {
+				return
+			}
+			flusher.Flush()
+		case e := <-eventCh:
+			data, err := json.Marshal(e.data)
+			if err != nil {
+				log.Printf("failed to encode event: %s", err.Error())
+				return
+			}
+			if _, err := fmt.Fprintf(w, "event: %s\ndata: %s\n\n", e.name, data); err != nil {
+				return
+			}
+			flusher.Flush()
+		}
+	}
+}
+
+// pollEvents returns images updated after `since` (RFC 3339, now if empty) and the counts.
+// `next` of the response is `since` of the next poll.
+func (app *App) pollEvents(w http.ResponseWriter, r *http.Request) {
+	since := time.Now()
+	if value := r.URL.Query().Get("since"); value != "" {
+		t, err := time.Parse(time.RFC3339Nano, value)
+		if err != nil {
+			http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+			return
+		}
+		since = t
+	}
+	results := &eventsResponse{
+		Images: []*eventResponse{},
+	}
+	if err := func() error {
+		documents, err := app.fsClient.Collection(entity.KindNameImage).
+			Where("UpdatedAt", ">", since).
+			OrderBy("UpdatedAt", firestore.Asc).
+			Limit(pollLimit).
+			Documents(r.Context()).
+			GetAll()
+		if err != nil {
+			return err
+		}
+		for _, document := range documents {
+			var image entity.Image
+			if err := document.DataTo(&image); err != nil {
+				return err
+			}
+			results.Images = append(results.Images, newEventResponse(&image))
+			since = image.UpdatedAt
+		}
+		results.Stats, err = app.counts(r.Context())
+		return err
+	}(); err != nil {
+		log.Printf("failed to poll events: %s", err.Error())
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	results.Next = since.Format(time.RFC3339Nano)
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(results); err != nil {
+		log.Printf("failed to encode events: %s", err.Error())
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+}
+
+// watch images updated after `since`
+func (app *App) watchImages(ctx context.Context, since time.Time, eventCh chan<- *event, errCh chan<- error) {
+	iter := app.fsClient.Collection(entity.KindNameImage).
+		Where("UpdatedAt", ">", since).
+		Snapshots(ctx)
+	defer iter.Stop()
+	for {
+		snapshot, err := iter.Next()
+		if err != nil {
+			if ctx.Err() == nil {
+				errCh <- err
+			}
+			return
+		}
+		for _, change := range snapshot.Changes {
+			if change.Kind == firestore.DocumentRemoved {
+				continue
+			}
+			var image entity.Image
+			if err := change.Doc.DataTo(&image); err != nil {
+				errCh <- err
+				return
+			}
+			select {
+			case eventCh <- &event{
+				name: "image",
+				data: newEventResponse(&image),
+			}:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}
+}
+
+// watch all count documents
+func (app *App) watchCounts(ctx context.Context, eventCh chan<- *event, errCh chan<- error) {
+	iter := app.fsClient.Collection(entity.KindNameCount).
+		OrderBy(firestore.DocumentID, firestore.Asc).
+		Snapshots(ctx)
+	defer iter.Stop()
+	for {
+		snapshot, err := iter.Next()
+		if err != nil {
+			if ctx.Err() == nil {
+				errCh <- err
+			}
+			return
+		}
+		if len(snapshot.Changes) == 0 {
+			continue
+		}
+		documents, err := snapshot.Documents.GetAll()
+		if err != nil {
+			errCh <- err
+			return
+		}
+		results := []*countResponse{}
+		for _, document := range documents {
+			var count entity.Count
+			if err := document.DataTo(&count); err != nil {
+				errCh <- err
+				return
+			}
+			results = append(results, newCountResponse(document.Ref.ID, &count))
+		}
+		select {
+		case eventCh <- &event{name: "stats", data: results}:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func newEventResponse(image *entity.Image) *eventResponse {
+	return &eventResponse{
+		ID:        image.ID,
+		Status:    int(image.Status),
+		UpdatedAt: image.UpdatedAt.Unix(),
+		UpdatedBy: image.UpdatedBy,
+	}
+}
@@ -0,0 +1,65 @@
+package app
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+
+	"cloud.google.com/go/firestore"
+	"github.com/sugyan/image-dataset/web/entity"
+	"google.golang.org/api/iterator"
+)
+
+func (app *App) labelsHandler(w http.ResponseWriter, r *http.Request) {
+	values := r.URL.Query()
+	count, err := queryCount(values)
+	if err != nil {
+		log.Printf("invalid count: %s", err.Error())
+		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return
+	}
+	query := app.fsClient.Collection(entity.KindNameLabel).
+		OrderBy("Name", firestore.Asc).
+		Limit(count)
+	if prefix := values.Get("prefix"); prefix != "" {
+		query = query.
+			Where("Name", ">=", prefix).
+			Where("Name", "<", prefix+"\uf8ff")
+	}
+	results := []*labelResponse{}
+	iter := query.Documents(r.Context())
+	for {
+		document, err := iter.Next()
+		if err != nil {
+			if errors.Is(err, iterator.Done) {
+				break
+			} else {
+				log.Printf("failed to fetch labels: %s", err.Error())
+				http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+				return
+			}
+		}
+		var label entity.Label
+		if err := document.DataTo(&label); err != nil {
+			log.Printf("failed to retrieve label from document: %s", err.Error())
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+		results = append(results, &labelResponse{
+			Name:      label.Name,
+			Ready:     label.Ready,
+			NG:        label.NG,
+			Pending:   label.Pending,
+			OK:        label.OK,
+			Predicted: label.Predicted,
+			Deleted:   label.Deleted,
+		})
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(&results); err != nil {
+		log.Printf("failed to encode labels: %s", err.Error())
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+}
@@ -0,0 +1,80 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"github.com/gorilla/mux"
+	"github.com/sugyan/image-dataset/web/entity"
+	"github.com/sugyan/image-dataset/web/geometry"
+)
+
+var errInvalidParts = errors.New("invalid parts")
+
+func (app *App) updatePartsHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	var data struct {
+		Parts []int `json:"parts"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&data); err != nil {
+		log.Printf("failed to decode json: %s", err.Error())
+		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return
+	}
+	if err := app.updateParts(r.Context(), vars["id"], data.Parts); err != nil {
+		log.Printf("failed to update parts: %s", err.Error())
+		if errors.Is(err, errInvalidParts) {
+			http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		} else if errors.Is(err, errImageDeleted) {
+			http.Error(w, http.StatusText(http.StatusConflict), http.StatusConflict)
+		} else {
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		}
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (app *App) updateParts(ctx context.Context, id string, parts []int) error {
+	if len(parts) != geometry.NumParts {
+		return fmt.Errorf("%w: %d coordinates", errInvalidParts, len(parts))
+	}
+	uid := app.uid(ctx)
+	return app.fsClient.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		docRef := app.fsClient.Collection(entity.KindNameImage).Doc(id)
+		doc, err := tx.Get(docRef)
+		if err != nil {
+			return err
+		}
+		var image entity.Image
+		if err := doc.DataTo(&image); err != nil {
+			return err
+		}
+		if image.Status == entity.StatusDeleted {
+			return errImageDeleted
+		}
+		// validate points within the image bounds
+		for i, v := range parts {
+			if v < 0 || v >= image.Size {
+				return fmt.Errorf("%w: point %d (%d) is out of bounds", errInvalidParts, i/2, v)
+			}
+		}
+		geo, err := geometry.Calculate(parts, image.Size)
+		if err != nil {
+			return fmt.Errorf("%w: %s", errInvalidParts, err.Error())
+		}
+		return tx.Update(docRef, []firestore.Update{
+			{Path: "CorrectedParts", Value: parts},
+			{Path: "PartsCorrected", Value: true},
+			{Path: "Geometry", Value: geo},
+			{Path: "UpdatedAt", Value: time.Now()},
+			{Path: "UpdatedBy", Value: uid},
+		})
+	})
+}
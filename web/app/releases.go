@@ -0,0 +1,264 @@
+package app
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/sugyan/image-dataset/web/entity"
+	"github.com/sugyan/image-dataset/web/release"
+	"google.golang.org/api/iterator"
+)
+
+// number of images fetched per page while freezing a release
+const releasePageSize = 500
+
+func (app *App) releasesHandler(w http.ResponseWriter, r *http.Request) {
+	releases, err := release.List(r.Context(), app.fsClient)
+	if err != nil {
+		log.Printf("failed to fetch releases: %s", err.Error())
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	results := []*releaseResponse{}
+	for _, rel := range releases {
+		results = append(results, newReleaseResponse(rel))
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(&results); err != nil {
+		log.Printf("failed to encode releases: %s", err.Error())
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+}
+
+func (app *App) releaseHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	rel, _, err := release.Get(r.Context(), app.fsClient, vars["name"])
+	if err != nil {
+		log.Printf("failed to get release: %s", err.Error())
+		if errors.Is(err, release.ErrNotFound) {
+			http.Error(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
+		} else {
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		}
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(newReleaseResponse(rel)); err != nil {
+		log.Printf("failed to encode release: %s", err.Error())
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+}
+
+func (app *App) createReleaseHandler(w http.ResponseWriter, r *http.Request) {
+	var data struct {
+		Name  string `json:"name"`
+		Query string `json:"query"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&data); err != nil {
+		log.Printf("failed to decode json: %s", err.Error())
+		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return
+	}
+	if !release.ValidName(data.Name) {
+		log.Printf("invalid release name: %s", data.Name)
+		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return
+	}
+	images, err := app.queryAllImages(r, data.Query)
+	if err != nil {
+		log.Printf("failed to query images: %s", err.Error())
+		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return
+	}
+	items := []*entity.ReleaseItem{}
+	for _, image := range images {
+		items = append(items, release.NewItem(image))
+	}
+	rel := &entity.Release{
+		Name:      data.Name,
+		Query:     data.Query,
+		CreatedAt: time.Now(),
+		CreatedBy: app.uid(r.Context()),
+	}
+	if err := release.Create(r.Context(), app.fsClient, rel, items); err != nil {
+		log.Printf("failed to create release: %s", err.Error())
+		if errors.Is(err, release.ErrExists) {
+			http.Error(w, http.StatusText(http.StatusConflict), http.StatusConflict)
+		} else {
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		}
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	if err := json.NewEncoder(w).Encode(newReleaseResponse(rel)); err != nil {
+		log.Printf("failed to encode release: %s", err.Error())
+		return
+	}
+}
+
+// queryAllImages returns all images matching the query parameters of `/api/images`
+func (app *App) queryAllImages(r *http.Request, rawQuery string) ([]*entity.Image, error) {
+	values, err := url.ParseQuery(rawQuery)
+	if err != nil {
+		return nil, err
+	}
+	values.Del("id")
+	values.Set("count", strconv.Itoa(releasePageSize))
+	req := r.Clone(r.Context())
+	req.URL.RawQuery = values.Encode()
+	query, err := app.makeQuery(req)
+	if err != nil {
+		return nil, err
+	}
+	excludes := values["-tag"]
+	images := []*entity.Image{}
+	for {
+		n := 0
+		iter := query.Documents(r.Context())
+		for {
+			document, err := iter.Next()
+			if err != nil {
+				if errors.Is(err, iterator.Done) {
+					break
+				} else {
+					return nil, err
+				}
+			}
+			*query = query.StartAfter(document)
+			n++
+
+			var image entity.Image
+			if err := document.DataTo(&image); err != nil {
+				return nil, err
+			}
+			if hasAnyTag(&image, excludes) {
+				continue
+			}
+			images = append(images, &image)
+		}
+		if n < releasePageSize {
+			break
+		}
+	}
+	return images, nil
+}
+
+func newReleaseResponse(rel *entity.Release) *releaseResponse {
+	return &releaseResponse{
+		Name:      rel.Name,
+		Query:     rel.Query,
+		Count:     rel.Count,
+		Checksum:  rel.Checksum,
+		CreatedAt: rel.CreatedAt.Unix(),
+		CreatedBy: rel.CreatedBy,
+	}
+}
+
+func (app *App) releaseDiffHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	diff, err := app.diffReleases(r, vars["a"], vars["b"])
+	if err != nil {
+		log.Printf("failed to diff releases: %s", err.Error())
+		if errors.Is(err, release.ErrNotFound) {
+			http.Error(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
+		} else {
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		}
+		return
+	}
+	if r.URL.Query().Get("format") == "csv" {
+		w.Header().Set("Content-Type", "text/csv")
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%s-%s.csv", vars["a"], vars["b"]))
+		if err := diff.WriteCSV(w); err != nil {
+			log.Printf("failed to write csv: %s", err.Error())
+		}
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(newReleaseDiffResponse(diff)); err != nil {
+		log.Printf("failed to encode diff: %s", err.Error())
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+}
+
+func (app *App) diffReleases(r *http.Request, a, b string) (*release.Diff, error) {
+	_, from, err := release.Get(r.Context(), app.fsClient, a)
+	if err != nil {
+		return nil, err
+	}
+	_, to, err := release.Get(r.Context(), app.fsClient, b)
+	if err != nil {
+		return nil, err
+	}
+	return release.Compare(from, to), nil
+}
+
+func newReleaseDiffResponse(diff *release.Diff) *releaseDiffResponse {
+	status := func(s *entity.Status) *int {
+		if s == nil {
+			return nil
+		}
+		v := int(*s)
+		return &v
+	}
+	result := &releaseDiffResponse{
+		Changes:     []*releaseChangeResponse{},
+		Labels:      []*releaseLabelResponse{},
+		Transitions: []*releaseTransitionResponse{},
+	}
+	for _, change := range diff.Changes {
+		c := &releaseChangeResponse{
+			ImageID: change.ImageID(),
+			Change:  change.Kind,
+		}
+		if change.From != nil {
+			c.LabelFrom, c.StatusFrom = change.From.LabelName, status(&change.From.Status)
+		}
+		if change.To != nil {
+			c.LabelTo, c.StatusTo = change.To.LabelName, status(&change.To.Status)
+		}
+		result.Changes = append(result.Changes, c)
+		switch change.Kind {
+		case release.ChangeAdded:
+			result.Added++
+		case release.ChangeRemoved:
+			result.Removed++
+		case release.ChangeRelabeled:
+			result.Relabeled++
+		case release.ChangeStatus:
+			result.Status++
+		case release.ChangeLandmarks:
+			result.Landmarks++
+		}
+	}
+	for _, label := range diff.Labels {
+		result.Labels = append(result.Labels, &releaseLabelResponse{
+			LabelName:        label.LabelName,
+			Added:            label.Added,
+			Removed:          label.Removed,
+			RelabeledFrom:    label.RelabeledFrom,
+			RelabeledTo:      label.RelabeledTo,
+			StatusChanged:    label.StatusChanged,
+			LandmarksChanged: label.LandmarksChanged,
+		})
+	}
+	for _, transition := range diff.Transitions {
+		result.Transitions = append(result.Transitions, &releaseTransitionResponse{
+			From:  status(transition.From),
+			To:    status(transition.To),
+			Count: transition.Count,
+		})
+	}
+	return result
+}
@@ -0,0 +1,134 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"github.com/sugyan/image-dataset/web/entity"
+	"google.golang.org/api/iterator"
+)
+
+func (app *App) claimHandler(w http.ResponseWriter, r *http.Request) {
+	data := struct {
+		Count int `json:"count"`
+		TTL   int `json:"ttl"`
+	}{
+		Count: limit,
+	}
+	if err := json.NewDecoder(r.Body).Decode(&data); err != nil {
+		log.Printf("failed to decode json: %s", err.Error())
+		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return
+	}
+	// a reviewer can not hold more than a page, to leave the queue to others
+	if data.Count <= 0 || data.Count > limit {
+		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return
+	}
+	// clients may shorten the lease, but not extend it beyond LEASE_TTL
+	ttl := app.leaseTTL
+	if data.TTL > 0 && data.TTL < int(ttl/time.Second) {
+		ttl = time.Duration(data.TTL) * time.Second
+	}
+	images, err := app.claimImages(r.Context(), data.Count, ttl)
+	if err != nil {
+		log.Printf("failed to claim images: %s", err.Error())
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	results := []*imageResponse{}
+	for _, image := range images {
+		results = append(results, newImageResponse(image))
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(&results); err != nil {
+		log.Printf("failed to encode images: %s", err.Error())
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+}
+
+// claimImages leases up to `count` Ready images to the current user.
+// Images leased by other users are skipped until their leases expire.
+func (app *App) claimImages(ctx context.Context, count int, ttl time.Duration) ([]*entity.Image, error) {
+	uid := app.uid(ctx)
+	collection := app.fsClient.Collection(entity.KindNameImage)
+	query := collection.
+		Where("Status", "==", entity.StatusReady).
+		OrderBy("ID", firestore.Asc)
+
+	claimed := []*entity.Image{}
+	for len(claimed) < count {
+		// collect candidates
+		candidates := []*firestore.DocumentRef{}
+		n := 0
+		iter := query.Limit(limit).Documents(ctx)
+		for {
+			document, err := iter.Next()
+			if err != nil {
+				if errors.Is(err, iterator.Done) {
+					break
+				} else {
+					return nil, err
+				}
+			}
+			query = query.StartAfter(document)
+			n++
+
+			var image entity.Image
+			if err := document.DataTo(&image); err != nil {
+				return nil, err
+			}
+			if !image.Leased(uid, time.Now()) {
+				candidates = append(candidates, document.Ref)
+			}
+		}
+		if n == 0 {
+			break
+		}
+		if len(candidates) == 0 {
+			continue
+		}
+		// lease candidates which are still available
+		var images []*entity.Image
+		if err := app.fsClient.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+			images = []*entity.Image{}
+			documents, err := tx.GetAll(candidates)
+			if err != nil {
+				return err
+			}
+			now := time.Now()
+			for _, document := range documents {
+				if len(claimed)+len(images) >= count {
+					break
+				}
+				var image entity.Image
+				if err := document.DataTo(&image); err != nil {
+					return err
+				}
+				if image.Status != entity.StatusReady || image.Leased(uid, now) {
+					continue
+				}
+				image.LeasedBy = uid
+				image.LeasedUntil = now.Add(ttl)
+				if err := tx.Update(document.Ref, []firestore.Update{
+					{Path: "LeasedBy", Value: image.LeasedBy},
+					{Path: "LeasedUntil", Value: image.LeasedUntil},
+				}); err != nil {
+					return err
+				}
+				images = append(images, &image)
+			}
+			return nil
+		}); err != nil {
+			return nil, err
+		}
+		claimed = append(claimed, images...)
+	}
+	return claimed, nil
+}
@@ -0,0 +1,186 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"github.com/sugyan/image-dataset/web/entity"
+)
+
+// maximum number of images per bulk update (bounded by the writes of a transaction)
+const maxTagUpdates = 100
+
+var errImageNotFound = errors.New("image is not found")
+
+var (
+	defaultTags = []string{"glasses", "occluded", "profile", "watermark", "multiple_faces"}
+	// tags are used as field paths of counts
+	tagRegexp = regexp.MustCompile(`^[a-z0-9_]+$`)
+)
+
+// parseTags parses comma separated tag vocabulary
+func parseTags(s string) ([]string, error) {
+	tags := []string{}
+	for _, tag := range strings.Split(s, ",") {
+		tag = strings.TrimSpace(tag)
+		if !tagRegexp.MatchString(tag) {
+			return nil, fmt.Errorf("invalid tag: %q", tag)
+		}
+		tags = append(tags, tag)
+	}
+	return tags, nil
+}
+
+func (app *App) isTag(tag string) bool {
+	for _, t := range app.tags {
+		if t == tag {
+			return true
+		}
+	}
+	return false
+}
+
+func (app *App) tagsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(app.tags); err != nil {
+		log.Printf("failed to encode tags: %s", err.Error())
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+}
+
+func (app *App) updateTagsHandler(w http.ResponseWriter, r *http.Request) {
+	var data struct {
+		IDs    []string `json:"ids"`
+		Add    []string `json:"add"`
+		Remove []string `json:"remove"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&data); err != nil {
+		log.Printf("failed to decode json: %s", err.Error())
+		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return
+	}
+	if len(data.IDs) == 0 || len(data.IDs) > maxTagUpdates {
+		log.Printf("invalid number of ids: %d", len(data.IDs))
+		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return
+	}
+	for _, tag := range append(data.Add, data.Remove...) {
+		if !app.isTag(tag) {
+			log.Printf("invalid tag: %s", tag)
+			http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+			return
+		}
+	}
+	if err := app.updateTags(r.Context(), data.IDs, data.Add, data.Remove); err != nil {
+		log.Printf("failed to update tags: %s", err.Error())
+		if errors.Is(err, errImageNotFound) {
+			http.Error(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
+		} else {
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		}
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (app *App) updateTags(ctx context.Context, ids, add, remove []string) error {
+	uid := app.uid(ctx)
+	return app.fsClient.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		collection := app.fsClient.Collection(entity.KindNameImage)
+		docRefs := []*firestore.DocumentRef{}
+		for _, id := range ids {
+			docRefs = append(docRefs, collection.Doc(id))
+		}
+		documents, err := tx.GetAll(docRefs)
+		if err != nil {
+			return err
+		}
+		// differences of counts for each size
+		diffs := []map[string]int{{}, {}, {}}
+		for _, document := range documents {
+			if !document.Exists() {
+				return fmt.Errorf("%w: %s", errImageNotFound, document.Ref.ID)
+			}
+			var image entity.Image
+			if err := document.DataTo(&image); err != nil {
+				return err
+			}
+			// images in the trash are excluded from tag counts
+			if image.Status == entity.StatusDeleted {
+				continue
+			}
+			tags := map[string]bool{}
+			for _, tag := range image.Tags {
+				tags[tag] = true
+			}
+			changed := false
+			for _, tag := range add {
+				if !tags[tag] {
+					tags[tag], changed = true, true
+					for i, b := range []bool{image.Size0256, image.Size0512, image.Size1024} {
+						if b {
+							diffs[i][tag]++
+						}
+					}
+				}
+			}
+			for _, tag := range remove {
+				if tags[tag] {
+					delete(tags, tag)
+					changed = true
+					for i, b := range []bool{image.Size0256, image.Size0512, image.Size1024} {
+						if b {
+							diffs[i][tag]--
+						}
+					}
+				}
+			}
+			if !changed {
+				continue
+			}
+			image.Tags = []string{}
+			for tag := range tags {
+				image.Tags = append(image.Tags, tag)
+			}
+			sort.Strings(image.Tags)
+			if err := tx.Update(document.Ref, []firestore.Update{
+				{Path: "Tags", Value: image.Tags},
+				{Path: "UpdatedAt", Value: time.Now()},
+				{Path: "UpdatedBy", Value: uid},
+			}); err != nil {
+				return err
+			}
+		}
+		// Update counts
+		for i, diff := range diffs {
+			updates := []firestore.Update{}
+			for tag, n := range diff {
+				if n != 0 {
+					updates = append(updates, firestore.Update{
+						Path:  "Tags." + tag,
+						Value: firestore.Increment(n),
+					})
+				}
+			}
+			if len(updates) == 0 {
+				continue
+			}
+			docID := []string{"0256", "0512", "1024"}[i]
+			ref := app.fsClient.Collection(entity.KindNameCount).Doc(docID)
+			if err := tx.Update(ref, updates); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
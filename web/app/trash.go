@@ -0,0 +1,102 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+
+	"cloud.google.com/go/firestore"
+	"github.com/gorilla/mux"
+	"github.com/sugyan/image-dataset/web/entity"
+)
+
+var (
+	errImageDeleted    = errors.New("image is deleted")
+	errImageNotDeleted = errors.New("image is not deleted")
+)
+
+func (app *App) deleteImageHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	if err := app.trashImage(r.Context(), vars["id"]); err != nil {
+		log.Printf("failed to delete image: %s", err.Error())
+		if errors.Is(err, errImageDeleted) {
+			http.Error(w, http.StatusText(http.StatusConflict), http.StatusConflict)
+		} else {
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		}
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (app *App) restoreImageHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	image, err := app.restoreImage(r.Context(), vars["id"])
+	if err != nil {
+		log.Printf("failed to restore image: %s", err.Error())
+		if errors.Is(err, errImageNotDeleted) {
+			http.Error(w, http.StatusText(http.StatusConflict), http.StatusConflict)
+		} else {
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		}
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(newImageResponse(image)); err != nil {
+		log.Printf("failed to encode image: %s", err.Error())
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+}
+
+// trashImage moves the image to the trash, to be purged after the retention period
+func (app *App) trashImage(ctx context.Context, id string) error {
+	uid := app.uid(ctx)
+	return app.fsClient.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		docRef := app.fsClient.Collection(entity.KindNameImage).Doc(id)
+		doc, err := tx.Get(docRef)
+		if err != nil {
+			return err
+		}
+		var image entity.Image
+		if err := doc.DataTo(&image); err != nil {
+			return err
+		}
+		if image.Status == entity.StatusDeleted {
+			return errImageDeleted
+		}
+		return app.setStatus(tx, docRef, &image, entity.StatusDeleted, uid)
+	})
+}
+
+// restoreImage moves the image back from the trash with the status before deleted,
+// and returns the restored image
+func (app *App) restoreImage(ctx context.Context, id string) (*entity.Image, error) {
+	uid := app.uid(ctx)
+	var image entity.Image
+	err := app.fsClient.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		docRef := app.fsClient.Collection(entity.KindNameImage).Doc(id)
+		doc, err := tx.Get(docRef)
+		if err != nil {
+			return err
+		}
+		image = entity.Image{}
+		if err := doc.DataTo(&image); err != nil {
+			return err
+		}
+		if image.Status != entity.StatusDeleted {
+			return errImageNotDeleted
+		}
+		status := image.PreviousStatus
+		if !isActive(status) {
+			status = entity.StatusReady
+		}
+		return app.setStatus(tx, docRef, &image, status, uid)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &image, nil
+}
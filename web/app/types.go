@@ -1,24 +1,139 @@
 package app
 
 type imageResponse struct {
-	ID          string `json:"id"`
-	ImageURL    string `json:"image_url"`
-	Size        int    `json:"size"`
-	Status      int    `json:"status"`
-	Parts       []int  `json:"parts"`
-	LabelName   string `json:"label_name"`
-	SourceURL   string `json:"source_url"`
-	PhotoURL    string `json:"photo_url"`
-	PublishedAt int64  `json:"published_at"`
-	UpdatedAt   int64  `json:"updated_at"`
-	Meta        string `json:"meta"`
+	ID          string              `json:"id"`
+	ImageURL    string              `json:"image_url"`
+	Size        int                 `json:"size"`
+	Status      int                 `json:"status"`
+	Parts       []int               `json:"parts"`
+	Corrected   bool                `json:"parts_corrected"`
+	LabelName   string              `json:"label_name"`
+	SourceURL   string              `json:"source_url"`
+	PhotoURL    string              `json:"photo_url"`
+	PublishedAt int64               `json:"published_at"`
+	UpdatedAt   int64               `json:"updated_at"`
+	UpdatedBy   string              `json:"updated_by"`
+	LeasedBy    string              `json:"leased_by"`
+	LeasedUntil int64               `json:"leased_until"`
+	Prediction  *predictionResponse `json:"prediction"`
+	Tags        []string            `json:"tags"`
+	HasComments bool                `json:"has_comments"`
+	Meta        *metaResponse       `json:"meta"`
+	Geometry    *geometryResponse   `json:"geometry"`
+	Quality     *qualityResponse    `json:"quality"`
 }
 
-type countResponse struct {
-	Size      string `json:"size"`
+type metaResponse struct {
+	Angle   float64 `json:"angle"`
+	PhotoID int64   `json:"photo_id,omitempty"`
+	LabelID int64   `json:"label_id,omitempty"`
+}
+
+type geometryResponse struct {
+	InterOcular float64 `json:"inter_ocular"`
+	FaceWidth   float64 `json:"face_width"`
+	Yaw         float64 `json:"yaw"`
+	Pitch       float64 `json:"pitch"`
+	Roll        float64 `json:"roll"`
+}
+
+type qualityResponse struct {
+	Sharpness   float64 `json:"sharpness"`
+	Brightness  float64 `json:"brightness"`
+	Contrast    float64 `json:"contrast"`
+	JPEGQuality int     `json:"jpeg_quality"`
+}
+
+type predictionResponse struct {
+	Class        string  `json:"class"`
+	Confidence   float64 `json:"confidence"`
+	Margin       float64 `json:"margin"`
+	ModelVersion string  `json:"model_version"`
+}
+
+type labelResponse struct {
+	Name      string `json:"name"`
 	Ready     int    `json:"status_ready"`
 	NG        int    `json:"status_ng"`
 	Pending   int    `json:"status_pending"`
 	OK        int    `json:"status_ok"`
 	Predicted int    `json:"status_predicted"`
+	Deleted   int    `json:"status_deleted"`
+}
+
+type commentResponse struct {
+	ID        string `json:"id"`
+	UID       string `json:"uid"`
+	Text      string `json:"text"`
+	CreatedAt int64  `json:"created_at"`
+}
+
+type countResponse struct {
+	Size      string         `json:"size"`
+	Ready     int            `json:"status_ready"`
+	NG        int            `json:"status_ng"`
+	Pending   int            `json:"status_pending"`
+	OK        int            `json:"status_ok"`
+	Predicted int            `json:"status_predicted"`
+	Deleted   int            `json:"status_deleted"`
+	Tags      map[string]int `json:"tags"`
+}
+
+type releaseResponse struct {
+	Name      string `json:"name"`
+	Query     string `json:"query"`
+	Count     int    `json:"count"`
+	Checksum  string `json:"checksum"`
+	CreatedAt int64  `json:"created_at"`
+	CreatedBy string `json:"created_by"`
+}
+
+type releaseDiffResponse struct {
+	Added       int                          `json:"added"`
+	Removed     int                          `json:"removed"`
+	Relabeled   int                          `json:"relabeled"`
+	Status      int                          `json:"status"`
+	Landmarks   int                          `json:"landmarks"`
+	Labels      []*releaseLabelResponse      `json:"labels"`
+	Transitions []*releaseTransitionResponse `json:"transitions"`
+	Changes     []*releaseChangeResponse     `json:"changes"`
+}
+
+type releaseLabelResponse struct {
+	LabelName        string `json:"label_name"`
+	Added            int    `json:"added"`
+	Removed          int    `json:"removed"`
+	RelabeledFrom    int    `json:"relabeled_from"`
+	RelabeledTo      int    `json:"relabeled_to"`
+	StatusChanged    int    `json:"status_changed"`
+	LandmarksChanged int    `json:"landmarks_changed"`
+}
+
+// nil status for added or removed images
+type releaseTransitionResponse struct {
+	From  *int `json:"from"`
+	To    *int `json:"to"`
+	Count int  `json:"count"`
+}
+
+type releaseChangeResponse struct {
+	ImageID    string `json:"image_id"`
+	Change     string `json:"change"`
+	LabelFrom  string `json:"label_from"`
+	LabelTo    string `json:"label_to"`
+	StatusFrom *int   `json:"status_from"`
+	StatusTo   *int   `json:"status_to"`
+}
+
+type eventResponse struct {
+	ID        string `json:"id"`
+	Status    int    `json:"status"`
+	UpdatedAt int64  `json:"updated_at"`
+	UpdatedBy string `json:"updated_by"`
+}
+
+type eventsResponse struct {
+	Images []*eventResponse `json:"images"`
+	Stats  []*countResponse `json:"stats"`
+	Next   string           `json:"next"`
 }
@@ -0,0 +1,99 @@
+package app
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"github.com/sugyan/image-dataset/web/entity"
+	"google.golang.org/api/iterator"
+)
+
+// consensus decides the status of an image from reviewers' votes:
+// `agree` of `votes` votes must agree, otherwise the image goes to Pending.
+type consensus struct {
+	agree int
+	votes int
+}
+
+// parseConsensus parses "K/N" format
+func parseConsensus(s string) (*consensus, error) {
+	kn := strings.SplitN(s, "/", 2)
+	if len(kn) != 2 {
+		return nil, fmt.Errorf("invalid consensus: %s", s)
+	}
+	k, err := strconv.Atoi(kn[0])
+	if err != nil {
+		return nil, err
+	}
+	n, err := strconv.Atoi(kn[1])
+	if err != nil {
+		return nil, err
+	}
+	if k <= 0 || k > n {
+		return nil, fmt.Errorf("invalid consensus: %s", s)
+	}
+	return &consensus{agree: k, votes: n}, nil
+}
+
+// decide returns the final status, or nil if it is not decided yet.
+// Ties between statuses are treated as disagreement.
+func (c *consensus) decide(votes map[string]entity.Status) *entity.Status {
+	counts := map[entity.Status]int{}
+	for _, status := range votes {
+		counts[status]++
+	}
+	var decided *entity.Status
+	max, tie := 0, false
+	for status, count := range counts {
+		if count > max {
+			s := status
+			decided, max, tie = &s, count, false
+		} else if count == max {
+			tie = true
+		}
+	}
+	if max >= c.agree && !tie {
+		return decided
+	}
+	if len(votes) >= c.votes {
+		pending := entity.StatusPending
+		return &pending
+	}
+	return nil
+}
+
+// vote stores the vote of uid and returns the status decided by consensus
+func (app *App) vote(tx *firestore.Transaction, docRef *firestore.DocumentRef, uid string, status entity.Status) (*entity.Status, error) {
+	collection := docRef.Collection(entity.KindNameVote)
+	votes := map[string]entity.Status{}
+	iter := tx.Documents(collection)
+	for {
+		document, err := iter.Next()
+		if err != nil {
+			if errors.Is(err, iterator.Done) {
+				break
+			} else {
+				return nil, err
+			}
+		}
+		var vote entity.Vote
+		if err := document.DataTo(&vote); err != nil {
+			return nil, err
+		}
+		votes[vote.UID] = vote.Status
+	}
+	votes[uid] = status
+	if err := tx.Set(collection.Doc(uid), &entity.Vote{
+		ImageID:   docRef.ID,
+		UID:       uid,
+		Status:    status,
+		CreatedAt: time.Now(),
+	}); err != nil {
+		return nil, err
+	}
+	return app.consensus.decide(votes), nil
+}
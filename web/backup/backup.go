@@ -0,0 +1,71 @@
+// Package backup defines the format of dataset backups written by cmd/backup and read by cmd/restore.
+package backup
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/sugyan/image-dataset/web/entity"
+)
+
+// Files in a backup directory
+const (
+	// documents of all collections in NDJSON, one file per collection kind
+	DocumentsExt = ".ndjson"
+	// tar of the objects under `images/` of the bucket
+	ImagesFile = "images.tar"
+	// checksums of the files above in the format of `sha256sum`
+	ChecksumsFile = "SHA256SUMS"
+)
+
+// Kinds are backed up in this order, subcollection kinds after their parents
+var Kinds = []string{
+	entity.KindNameImage,
+	entity.KindNameVote,
+	entity.KindNameComment,
+	entity.KindNameCount,
+	entity.KindNameLabel,
+	entity.KindNameMetadata,
+	entity.KindNameRelease,
+	entity.KindNameReleaseChunk,
+}
+
+// Record is a line of NDJSON files
+type Record struct {
+	// path of the document relative to the database, e.g. `Image/<id>/Vote/<uid>`
+	Path string          `json:"path"`
+	Data json.RawMessage `json:"data"`
+}
+
+// Kind returns the collection kind of the document
+func (r *Record) Kind() string {
+	segments := strings.Split(r.Path, "/")
+	if len(segments) < 2 {
+		return ""
+	}
+	return segments[len(segments)-2]
+}
+
+// NewEntity returns a pointer to the entity type stored in the collection of kind
+func NewEntity(kind string) (interface{}, error) {
+	switch kind {
+	case entity.KindNameImage:
+		return &entity.Image{}, nil
+	case entity.KindNameVote:
+		return &entity.Vote{}, nil
+	case entity.KindNameComment:
+		return &entity.Comment{}, nil
+	case entity.KindNameCount:
+		return &entity.Count{}, nil
+	case entity.KindNameLabel:
+		return &entity.Label{}, nil
+	case entity.KindNameMetadata:
+		return &entity.Migrations{}, nil
+	case entity.KindNameRelease:
+		return &entity.Release{}, nil
+	case entity.KindNameReleaseChunk:
+		return &entity.ReleaseChunk{}, nil
+	}
+	return nil, fmt.Errorf("unknown kind: %s", kind)
+}
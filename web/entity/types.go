@@ -1,16 +1,38 @@
 package entity
 
-import "time"
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+	"time"
+
+	"github.com/sugyan/image-dataset/web/geometry"
+	"github.com/sugyan/image-dataset/web/quality"
+)
 
 // Status Type
 type Status int
 
 // Kind name
 const (
-	KindNameImage = "Image"
-	KindNameCount = "Count"
+	KindNameImage    = "Image"
+	KindNameCount    = "Count"
+	KindNameVote     = "Vote"
+	KindNameComment  = "Comment"
+	KindNameLabel    = "Label"
+	KindNameMetadata = "Metadata"
+	KindNameRelease  = "Release"
+	// subcollection of Release
+	KindNameReleaseChunk = "ReleaseChunk"
 )
 
+// SchemaVersion is the version of Image documents written by the current code.
+// It must be the number of the latest migration of cmd/migrate.
+const SchemaVersion = 4
+
+// DocNameMigrations is the document of KindNameMetadata which records migrations
+const DocNameMigrations = "migrations"
+
 // Status values
 const (
 	StatusReady Status = iota
@@ -18,8 +40,13 @@ const (
 	StatusPending
 	StatusOK
 	StatusPredicted
+	// moved to the trash, excluded from listings and counts until restored or purged
+	StatusDeleted
 )
 
+// ActiveStatuses are the statuses of images not in the trash
+var ActiveStatuses = []Status{StatusReady, StatusNG, StatusPending, StatusOK, StatusPredicted}
+
 // Path of status
 func (s Status) Path() string {
 	switch s {
@@ -33,6 +60,8 @@ func (s Status) Path() string {
 		return "OK"
 	case StatusPredicted:
 		return "Predicted"
+	case StatusDeleted:
+		return "Deleted"
 	default:
 		return ""
 	}
@@ -40,21 +69,69 @@ func (s Status) Path() string {
 
 // Image type
 type Image struct {
-	ID          string
-	ImageURL    string
-	SourceURL   string
-	PhotoURL    string
-	Size        int
-	Size0256    bool
-	Size0512    bool
-	Size1024    bool
-	Parts       []int
-	LabelName   string
-	Status      Status
-	PublishedAt time.Time
-	CreatedAt   time.Time
-	UpdatedAt   time.Time
-	Meta        []byte `datastore:",noindex"`
+	ID             string
+	ImageURL       string
+	SourceURL      string
+	PhotoURL       string
+	Size           int
+	Size0256       bool
+	Size0512       bool
+	Size1024       bool
+	Parts          []int
+	CorrectedParts []int
+	PartsCorrected bool
+	LabelName      string
+	Status         Status
+	// omitted if unknown
+	PublishedAt    time.Time `firestore:",omitempty"`
+	CreatedAt      time.Time
+	UpdatedAt      time.Time
+	UpdatedBy      string
+	LeasedBy       string
+	LeasedUntil    time.Time
+	PredictedClass string
+	Confidence     float64
+	Margin         float64
+	ModelVersion   string
+	Tags           []string
+	HasComments    bool
+	Meta           Meta
+	Geometry       *geometry.Geometry
+	Quality        *quality.Quality
+	SchemaVersion  int
+	DeletedAt      time.Time
+	// status to restore from the trash
+	PreviousStatus Status
+}
+
+// Meta type
+type Meta struct {
+	Angle   float64
+	PhotoID int64
+	LabelID int64
+}
+
+// Leased reports whether the image is leased to a reviewer other than uid at t
+func (image *Image) Leased(uid string, t time.Time) bool {
+	return image.LeasedBy != "" && image.LeasedBy != uid && image.LeasedUntil.After(t)
+}
+
+// Landmarks returns the manually corrected landmarks if exist
+func (image *Image) Landmarks() []int {
+	if image.PartsCorrected {
+		return image.CorrectedParts
+	}
+	return image.Parts
+}
+
+// HasTag reports whether the image is tagged with tag
+func (image *Image) HasTag(tag string) bool {
+	for _, t := range image.Tags {
+		if t == tag {
+			return true
+		}
+	}
+	return false
 }
 
 // Count type
@@ -64,4 +141,89 @@ type Count struct {
 	Pending   int
 	OK        int
 	Predicted int
+	Deleted   int
+	Tags      map[string]int
+}
+
+// Label type, keyed by LabelDocID of Name
+type Label struct {
+	Name      string
+	Ready     int
+	NG        int
+	Pending   int
+	OK        int
+	Predicted int
+	Deleted   int
+}
+
+// LabelDocID returns the document ID of the Label named name.
+// Labels come from screen names, directory names or feed titles, so characters
+// invalid in document IDs are escaped, and too long names are hashed.
+func LabelDocID(name string) string {
+	id := strings.NewReplacer("%", "%25", "/", "%2F").Replace(name)
+	if strings.HasPrefix(id, ".") {
+		id = "%2E" + id[1:]
+	}
+	if strings.HasPrefix(id, "__") {
+		id = "%5F" + id[1:]
+	}
+	if len(id) > 1500 {
+		sum := sha256.Sum256([]byte(name))
+		id = hex.EncodeToString(sum[:])
+	}
+	return id
+}
+
+// Vote type
+type Vote struct {
+	ImageID   string
+	UID       string
+	Status    Status
+	CreatedAt time.Time
+}
+
+// Migrations type, records applied versions of cmd/migrate
+type Migrations struct {
+	Version int
+	// ID of the last migrated image of the next version, to resume
+	Cursor    string
+	UpdatedAt time.Time
+}
+
+// Comment type
+type Comment struct {
+	ImageID   string
+	UID       string
+	Text      string
+	CreatedAt time.Time
+}
+
+// Release type, a frozen set of images keyed by Name
+type Release struct {
+	Name string
+	// query parameters of `/api/images` which selected the images
+	Query     string
+	Count     int
+	Checksum  string
+	Chunks    int
+	CreatedAt time.Time
+	CreatedBy string
+	// the name is reserved while its chunks are being written
+	Pending bool
+}
+
+// ReleaseChunk type, keyed by the index in the release
+type ReleaseChunk struct {
+	Items []*ReleaseItem
+}
+
+// ReleaseItem type, an image at the time of the release
+type ReleaseItem struct {
+	ImageID        string
+	ImageURL       string
+	Size           int
+	Status         Status
+	LabelName      string
+	Landmarks      []int
+	PartsCorrected bool
 }
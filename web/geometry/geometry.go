@@ -0,0 +1,104 @@
+// Package geometry estimates face geometry from 68 facial landmarks.
+package geometry
+
+import (
+	"errors"
+	"math"
+)
+
+// NumParts is the number of coordinates of 68 facial landmarks
+const NumParts = 68 * 2
+
+// ratios of the nose tip between eyes and mouth for frontal faces
+const frontalNoseRatio = 0.55
+
+// Geometry of a face
+type Geometry struct {
+	// distance between the eye centers relative to the image size
+	InterOcular float64
+	// distance between the jaw ends relative to the image size
+	FaceWidth float64
+	// rough estimations of head pose in degrees
+	Yaw   float64
+	Pitch float64
+	Roll  float64
+}
+
+type point struct {
+	x, y float64
+}
+
+func (p point) sub(q point) point {
+	return point{p.x - q.x, p.y - q.y}
+}
+
+func (p point) norm() float64 {
+	return math.Hypot(p.x, p.y)
+}
+
+func (p point) rotate(rad float64) point {
+	sin, cos := math.Sincos(rad)
+	return point{p.x*cos - p.y*sin, p.x*sin + p.y*cos}
+}
+
+func center(points []point) point {
+	c := point{}
+	for _, p := range points {
+		c.x += p.x
+		c.y += p.y
+	}
+	return point{c.x / float64(len(points)), c.y / float64(len(points))}
+}
+
+// Calculate returns geometry from flattened landmarks coordinates of the image of `size`
+func Calculate(parts []int, size int) (*Geometry, error) {
+	if len(parts) != NumParts {
+		return nil, errors.New("invalid number of parts")
+	}
+	if size <= 0 {
+		return nil, errors.New("invalid size")
+	}
+	points := make([]point, len(parts)/2)
+	for i := range points {
+		points[i] = point{float64(parts[i*2]), float64(parts[i*2+1])}
+	}
+	eyeL, eyeR := center(points[36:42]), center(points[42:48])
+	eyes := eyeR.sub(eyeL)
+	roll := math.Atan2(eyes.y, eyes.x)
+
+	// align to the eyes line, origin at the center of eyes
+	origin := center([]point{eyeL, eyeR})
+	aligned := make([]point, len(points))
+	for i, p := range points {
+		aligned[i] = p.sub(origin).rotate(-roll)
+	}
+	nose := aligned[30]
+	jawL, jawR := aligned[0], aligned[16]
+	mouth := center([]point{aligned[48], aligned[54]})
+
+	// yaw: horizontal position of the nose tip between the jaw ends
+	yaw := 0.0
+	if d := (nose.x - jawL.x) + (jawR.x - nose.x); d > 0 {
+		yaw = math.Asin(clamp(((nose.x-jawL.x)-(jawR.x-nose.x))/d, -1, 1))
+	}
+	// pitch: vertical position of the nose tip between the eyes and the mouth
+	pitch := 0.0
+	if mouth.y > 0 {
+		pitch = math.Asin(clamp((nose.y/mouth.y-frontalNoseRatio)*2, -1, 1))
+	}
+	return &Geometry{
+		InterOcular: eyes.norm() / float64(size),
+		FaceWidth:   points[16].sub(points[0]).norm() / float64(size),
+		Yaw:         degrees(yaw),
+		Pitch:       degrees(pitch),
+		Roll:        degrees(roll),
+	}, nil
+}
+
+func clamp(v, min, max float64) float64 {
+	return math.Max(min, math.Min(max, v))
+}
+
+func degrees(rad float64) float64 {
+	return rad * 180.0 / math.Pi
+}
@@ -0,0 +1,167 @@
+package geometry
+
+import (
+	"math"
+	"testing"
+)
+
+// landmarks returns flattened 68 landmarks with the points used by Calculate
+func landmarks(eyeL, eyeR, nose, jawL, jawR, mouthL, mouthR point) []int {
+	points := make([]point, NumParts/2)
+	for i := 36; i < 42; i++ {
+		points[i] = eyeL
+	}
+	for i := 42; i < 48; i++ {
+		points[i] = eyeR
+	}
+	points[30] = nose
+	points[0], points[16] = jawL, jawR
+	points[48], points[54] = mouthL, mouthR
+	parts := make([]int, NumParts)
+	for i, p := range points {
+		parts[i*2], parts[i*2+1] = int(math.Round(p.x)), int(math.Round(p.y))
+	}
+	return parts
+}
+
+// frontal returns landmarks of a frontal face centered at (500, 500) rotated by deg,
+// with the nose tip moved by (dx, dy) before the rotation
+func frontal(deg, dx, dy float64) []int {
+	c := point{500, 500}
+	rad := deg * math.Pi / 180.0
+	p := func(x, y float64) point {
+		q := point{x, y}.rotate(rad)
+		return point{c.x + q.x, c.y + q.y}
+	}
+	return landmarks(
+		p(-150, 0), p(150, 0),
+		// frontalNoseRatio between the eyes and the mouth
+		p(dx, 0.55*400+dy),
+		p(-300, 50), p(300, 50),
+		p(-100, 400), p(100, 400),
+	)
+}
+
+func TestCalculate(t *testing.T) {
+	testCases := []struct {
+		name     string
+		parts    []int
+		size     int
+		expected Geometry
+	}{
+		{
+			name:  "frontal",
+			parts: frontal(0, 0, 0),
+			size:  1000,
+			expected: Geometry{
+				InterOcular: 0.3,
+				FaceWidth:   0.6,
+			},
+		},
+		{
+			name:  "rolled",
+			parts: frontal(30, 0, 0),
+			size:  1000,
+			expected: Geometry{
+				InterOcular: 0.3,
+				FaceWidth:   0.6,
+				Roll:        30,
+			},
+		},
+		{
+			name:  "turned",
+			parts: frontal(0, 150, 0),
+			size:  1000,
+			expected: Geometry{
+				InterOcular: 0.3,
+				FaceWidth:   0.6,
+				Yaw:         30,
+			},
+		},
+		{
+			name:  "turned to the other side",
+			parts: frontal(0, -150, 0),
+			size:  1000,
+			expected: Geometry{
+				InterOcular: 0.3,
+				FaceWidth:   0.6,
+				Yaw:         -30,
+			},
+		},
+		{
+			name:  "pitched",
+			parts: frontal(0, 0, 100),
+			size:  1000,
+			expected: Geometry{
+				InterOcular: 0.3,
+				FaceWidth:   0.6,
+				Pitch:       30,
+			},
+		},
+		{
+			name:  "rolled and turned",
+			parts: frontal(-20, 150, 0),
+			size:  500,
+			expected: Geometry{
+				InterOcular: 0.6,
+				FaceWidth:   1.2,
+				Yaw:         30,
+				Roll:        -20,
+			},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			geo, err := Calculate(tc.parts, tc.size)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, v := range []struct {
+				name      string
+				got, want float64
+				tolerance float64
+			}{
+				{"InterOcular", geo.InterOcular, tc.expected.InterOcular, 0.01},
+				{"FaceWidth", geo.FaceWidth, tc.expected.FaceWidth, 0.01},
+				{"Yaw", geo.Yaw, tc.expected.Yaw, 1},
+				{"Pitch", geo.Pitch, tc.expected.Pitch, 1},
+				{"Roll", geo.Roll, tc.expected.Roll, 1},
+			} {
+				if math.Abs(v.got-v.want) > v.tolerance {
+					t.Errorf("%s: got %f, want %f", v.name, v.got, v.want)
+				}
+			}
+		})
+	}
+}
+
+func TestCalculateInvalid(t *testing.T) {
+	testCases := []struct {
+		name  string
+		parts []int
+		size  int
+	}{
+		{
+			name:  "no parts",
+			parts: []int{},
+			size:  1000,
+		},
+		{
+			name:  "too few parts",
+			parts: frontal(0, 0, 0)[:NumParts-2],
+			size:  1000,
+		},
+		{
+			name:  "zero size",
+			parts: frontal(0, 0, 0),
+			size:  0,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if _, err := Calculate(tc.parts, tc.size); err == nil {
+				t.Error("expected an error")
+			}
+		})
+	}
+}
@@ -0,0 +1,49 @@
+// Package purge deletes what remains of images deleted permanently by cmd/purge and cmd/delete_images.
+package purge
+
+import (
+	"context"
+	"errors"
+
+	"cloud.google.com/go/firestore"
+	"github.com/sugyan/image-dataset/web/entity"
+	"google.golang.org/api/iterator"
+)
+
+// DeleteSubcollections deletes Vote and Comment documents of the image,
+// which are not deleted with the parent document
+func DeleteSubcollections(ctx context.Context, fsClient *firestore.Client, imageID string) error {
+	docRef := fsClient.Collection(entity.KindNameImage).Doc(imageID)
+	for _, kind := range []string{entity.KindNameVote, entity.KindNameComment} {
+		if err := deleteCollection(ctx, fsClient, docRef.Collection(kind)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func deleteCollection(ctx context.Context, fsClient *firestore.Client, collection *firestore.CollectionRef) error {
+	for {
+		batch := fsClient.Batch()
+		n := 0
+		iter := collection.Limit(500).Documents(ctx)
+		for {
+			document, err := iter.Next()
+			if err != nil {
+				if errors.Is(err, iterator.Done) {
+					break
+				} else {
+					return err
+				}
+			}
+			batch.Delete(document.Ref)
+			n++
+		}
+		if n == 0 {
+			return nil
+		}
+		if _, err := batch.Commit(ctx); err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,174 @@
+// Package quality computes quality metrics of JPEG images.
+package quality
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"math"
+)
+
+// standard luminance quantization table of the JPEG specification (Annex K)
+var standardLuminance = [64]int{
+	16, 11, 10, 16, 24, 40, 51, 61,
+	12, 12, 14, 19, 26, 58, 60, 55,
+	14, 13, 16, 24, 40, 57, 69, 56,
+	14, 17, 22, 29, 51, 87, 80, 62,
+	18, 22, 37, 56, 68, 109, 103, 77,
+	24, 35, 55, 64, 81, 104, 113, 92,
+	49, 64, 78, 87, 103, 121, 120, 101,
+	72, 92, 95, 98, 112, 100, 103, 99,
+}
+
+// natural order indices of values in the zigzag order of DQT segments
+var zigzag = [64]int{
+	0, 1, 8, 16, 9, 2, 3, 10,
+	17, 24, 32, 25, 18, 11, 4, 5,
+	12, 19, 26, 33, 40, 48, 41, 34,
+	27, 20, 13, 6, 7, 14, 21, 28,
+	35, 42, 49, 56, 57, 50, 43, 36,
+	29, 22, 15, 23, 30, 37, 44, 51,
+	58, 59, 52, 45, 38, 31, 39, 46,
+	53, 60, 61, 54, 47, 55, 62, 63,
+}
+
+// Quality metrics of an image
+type Quality struct {
+	// variance of the Laplacian of luminance, lower is blurrier
+	Sharpness float64
+	// mean of luminance (0-255)
+	Brightness float64
+	// standard deviation of luminance
+	Contrast float64
+	// estimated JPEG quality factor (1-100) of the source photo, omitted if unknown.
+	// Faces are re-encoded when cropped, so it is not calculated from them.
+	JPEGQuality int `firestore:",omitempty"`
+}
+
+// Calculate returns quality metrics of the JPEG encoded data, except JPEGQuality
+func Calculate(data []byte) (*Quality, error) {
+	img, err := jpeg.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	w, h := img.Bounds().Dx(), img.Bounds().Dy()
+	if w < 3 || h < 3 {
+		return nil, errors.New("image is too small")
+	}
+	gray := luminance(img)
+
+	sum, sumSq := 0.0, 0.0
+	for _, v := range gray {
+		sum += v
+		sumSq += v * v
+	}
+	n := float64(len(gray))
+	mean := sum / n
+
+	lapSum, lapSumSq := 0.0, 0.0
+	for y := 1; y < h-1; y++ {
+		for x := 1; x < w-1; x++ {
+			i := y*w + x
+			v := gray[i-w] + gray[i+w] + gray[i-1] + gray[i+1] - 4*gray[i]
+			lapSum += v
+			lapSumSq += v * v
+		}
+	}
+	m := float64((w - 2) * (h - 2))
+	lapMean := lapSum / m
+
+	return &Quality{
+		Sharpness:  lapSumSq/m - lapMean*lapMean,
+		Brightness: mean,
+		Contrast:   math.Sqrt(math.Max(0, sumSq/n-mean*mean)),
+	}, nil
+}
+
+// luminance returns the luminance values of img in row-major order
+func luminance(img image.Image) []float64 {
+	bounds := img.Bounds()
+	w, h := bounds.Dx(), bounds.Dy()
+	gray := make([]float64, w*h)
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			var v uint8
+			switch img := img.(type) {
+			case *image.YCbCr:
+				v = img.Y[img.YOffset(bounds.Min.X+x, bounds.Min.Y+y)]
+			case *image.Gray:
+				v = img.Pix[img.PixOffset(bounds.Min.X+x, bounds.Min.Y+y)]
+			default:
+				v = color.GrayModel.Convert(img.At(bounds.Min.X+x, bounds.Min.Y+y)).(color.Gray).Y
+			}
+			gray[y*w+x] = float64(v)
+		}
+	}
+	return gray
+}
+
+// EstimateJPEGQuality compares the first quantization table with the standard one
+// scaled in the same way as libjpeg, and returns 0 if data is not JPEG
+func EstimateJPEGQuality(data []byte) int {
+	table := quantizationTable(data)
+	if table == nil {
+		return 0
+	}
+	sum, std := 0, 0
+	for i, q := range table {
+		// values of low qualities are clamped to 8 bits
+		if q >= 255 {
+			continue
+		}
+		sum += q
+		std += standardLuminance[zigzag[i]]
+	}
+	if std == 0 {
+		return 1
+	}
+	scale := float64(sum) * 100.0 / float64(std)
+	var quality float64
+	if scale <= 100.0 {
+		quality = (200.0 - scale) / 2.0
+	} else {
+		quality = 5000.0 / scale
+	}
+	return int(math.Max(1, math.Min(100, math.Round(quality))))
+}
+
+// quantizationTable returns the values of the first quantization table (DQT segment) in zigzag order
+func quantizationTable(data []byte) []int {
+	if len(data) < 4 || data[0] != 0xFF || data[1] != 0xD8 {
+		return nil
+	}
+	for i := 2; i+4 <= len(data); {
+		if data[i] != 0xFF {
+			return nil
+		}
+		marker := data[i+1]
+		length := int(binary.BigEndian.Uint16(data[i+2 : i+4]))
+		// start of scan: no more tables
+		if marker == 0xDA {
+			return nil
+		}
+		if marker == 0xDB && i+4+65 <= len(data) {
+			precision := data[i+4] >> 4
+			values := make([]int, 64)
+			for j := range values {
+				if precision == 0 {
+					values[j] = int(data[i+5+j])
+				} else {
+					if i+5+j*2+2 > len(data) {
+						return nil
+					}
+					values[j] = int(binary.BigEndian.Uint16(data[i+5+j*2:]))
+				}
+			}
+			return values
+		}
+		i += 2 + length
+	}
+	return nil
+}
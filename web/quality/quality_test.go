@@ -0,0 +1,168 @@
+package quality
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"math"
+	"testing"
+)
+
+func encode(t *testing.T, img image.Image, quality int) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: quality}); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// gray returns an image of size x size with values of f
+func gray(size int, f func(x, y int) uint8) image.Image {
+	img := image.NewGray(image.Rect(0, 0, size, size))
+	for y := 0; y < size; y++ {
+		for x := 0; x < size; x++ {
+			img.SetGray(x, y, color.Gray{Y: f(x, y)})
+		}
+	}
+	return img
+}
+
+func TestCalculate(t *testing.T) {
+	testCases := []struct {
+		name       string
+		img        image.Image
+		sharpness  float64
+		brightness float64
+		contrast   float64
+	}{
+		{
+			name:       "black",
+			img:        gray(64, func(x, y int) uint8 { return 0 }),
+			sharpness:  0,
+			brightness: 0,
+			contrast:   0,
+		},
+		{
+			name:       "flat",
+			img:        gray(64, func(x, y int) uint8 { return 128 }),
+			sharpness:  0,
+			brightness: 128,
+			contrast:   0,
+		},
+		{
+			name: "halves",
+			img: gray(64, func(x, y int) uint8 {
+				if x < 32 {
+					return 64
+				}
+				return 192
+			}),
+			// only the columns next to the edge have the Laplacian of -128 and 128
+			sharpness:  128 * 128 * 2 / 62.0,
+			brightness: 128,
+			contrast:   64,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			q, err := Calculate(encode(t, tc.img, 100))
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, v := range []struct {
+				name      string
+				got, want float64
+				tolerance float64
+			}{
+				{"Sharpness", q.Sharpness, tc.sharpness, tc.sharpness*0.1 + 1},
+				{"Brightness", q.Brightness, tc.brightness, 1},
+				{"Contrast", q.Contrast, tc.contrast, 1},
+			} {
+				if math.Abs(v.got-v.want) > v.tolerance {
+					t.Errorf("%s: got %f, want %f", v.name, v.got, v.want)
+				}
+			}
+			if q.JPEGQuality != 0 {
+				t.Errorf("JPEGQuality: got %d, want 0", q.JPEGQuality)
+			}
+		})
+	}
+}
+
+func TestCalculateSharpness(t *testing.T) {
+	sharp := gray(64, func(x, y int) uint8 { return uint8((x + y) % 2 * 255) })
+	blurred := gray(64, func(x, y int) uint8 { return uint8(x * 4) })
+	qs, err := Calculate(encode(t, sharp, 90))
+	if err != nil {
+		t.Fatal(err)
+	}
+	qb, err := Calculate(encode(t, blurred, 90))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if qs.Sharpness <= qb.Sharpness {
+		t.Errorf("sharpness of the checkerboard %f is not greater than the gradient %f", qs.Sharpness, qb.Sharpness)
+	}
+}
+
+func TestCalculateInvalid(t *testing.T) {
+	testCases := []struct {
+		name string
+		data []byte
+	}{
+		{
+			name: "empty",
+			data: []byte{},
+		},
+		{
+			name: "not jpeg",
+			data: []byte("GIF89a"),
+		},
+		{
+			name: "too small",
+			data: encode(t, gray(2, func(x, y int) uint8 { return 0 }), 90),
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if _, err := Calculate(tc.data); err == nil {
+				t.Error("expected an error")
+			}
+		})
+	}
+}
+
+func TestEstimateJPEGQuality(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 32, 32))
+	for y := 0; y < 32; y++ {
+		for x := 0; x < 32; x++ {
+			img.Set(x, y, color.RGBA{uint8(x * 8), uint8(y * 8), 128, 255})
+		}
+	}
+	testCases := []struct {
+		name     string
+		data     []byte
+		expected int
+	}{
+		{"quality 5", encode(t, img, 5), 5},
+		{"quality 10", encode(t, img, 10), 10},
+		{"quality 20", encode(t, img, 20), 20},
+		{"quality 30", encode(t, img, 30), 30},
+		{"quality 50", encode(t, img, 50), 50},
+		{"quality 75", encode(t, img, 75), 75},
+		{"quality 90", encode(t, img, 90), 90},
+		{"quality 100", encode(t, img, 100), 100},
+		{"not jpeg", []byte("GIF89a"), 0},
+		{"no tables", []byte{0xFF, 0xD8, 0xFF, 0xDA, 0x00, 0x02}, 0},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			// tables are rounded to integers, and clamped in low qualities
+			if got := EstimateJPEGQuality(tc.data); math.Abs(float64(got-tc.expected)) > 1 {
+				t.Errorf("got %d, want %d", got, tc.expected)
+			}
+		})
+	}
+}
@@ -0,0 +1,141 @@
+package queryspec
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Values of firestore.indexes.json
+const (
+	QueryScopeCollection = "COLLECTION"
+	OrderAsc             = "ASCENDING"
+	OrderDesc            = "DESCENDING"
+	ArrayConfigContains  = "CONTAINS"
+)
+
+// IndexesData is the format of firestore.indexes.json
+type IndexesData struct {
+	Indexes        []*Index         `json:"indexes"`
+	FieldOverrides []*FieldOverride `json:"fieldOverrides"`
+}
+
+// Index type
+type Index struct {
+	CollectionGroup string        `json:"collectionGroup"`
+	QueryScope      string        `json:"queryScope"`
+	Fields          []*IndexField `json:"fields"`
+}
+
+// IndexField type
+type IndexField struct {
+	FieldPath   string `json:"fieldPath"`
+	Order       string `json:"order,omitempty"`
+	ArrayConfig string `json:"arrayConfig,omitempty"`
+}
+
+// FieldOverride type
+type FieldOverride struct {
+	CollectionGroup string        `json:"collectionGroup"`
+	FieldPath       string        `json:"fieldPath"`
+	Indexes         []interface{} `json:"indexes"`
+}
+
+// Key returns a string which identifies the index
+func (index *Index) Key() string {
+	fields := []string{}
+	for _, f := range index.Fields {
+		fields = append(fields, fmt.Sprintf("%s:%s%s", f.FieldPath, f.Order, f.ArrayConfig))
+	}
+	return fmt.Sprintf("%s/%s(%s)", index.CollectionGroup, index.QueryScope, strings.Join(fields, ","))
+}
+
+// IndexOptions controls how indexes are generated
+type IndexOptions struct {
+	// use index merging: equality filters are served by merging
+	// indexes of each single filter field and the ordering field
+	Merge bool
+}
+
+// Indexes returns composite indexes required by the spec, without duplicates
+func (s *Spec) Indexes(opts *IndexOptions) []*Index {
+	indexes := []*Index{}
+	exists := map[string]bool{}
+	// descending orders are not served by ascending indexes
+	directions := []string{OrderAsc, OrderDesc}
+	for _, group := range s.Groups {
+		for _, fields := range group.combinations() {
+			if len(fields) == 0 {
+				continue
+			}
+			prefixes := [][]*IndexField{fields}
+			if opts.Merge {
+				prefixes = [][]*IndexField{}
+				for _, f := range fields {
+					prefixes = append(prefixes, []*IndexField{f})
+				}
+			}
+			for _, order := range group.Orders {
+				for _, direction := range directions {
+					for _, prefix := range prefixes {
+						index := &Index{
+							CollectionGroup: s.Collection,
+							QueryScope:      QueryScopeCollection,
+							Fields: appendField(prefix, &IndexField{
+								FieldPath: order,
+								Order:     direction,
+							}),
+						}
+						if exists[index.Key()] {
+							continue
+						}
+						exists[index.Key()] = true
+						indexes = append(indexes, index)
+					}
+				}
+			}
+		}
+	}
+	return indexes
+}
+
+// FieldOverrides returns overrides to exclude unindexed fields
+func (s *Spec) FieldOverrides() []*FieldOverride {
+	fieldOverrides := []*FieldOverride{}
+	for _, fieldPath := range s.Unindexed {
+		fieldOverrides = append(fieldOverrides, &FieldOverride{
+			CollectionGroup: s.Collection,
+			FieldPath:       fieldPath,
+			Indexes:         []interface{}{},
+		})
+	}
+	return fieldOverrides
+}
+
+// combinations returns the filter fields of all combinations of dimensions
+func (g *Group) combinations() [][]*IndexField {
+	results := [][]*IndexField{{}}
+	for _, dim := range g.Dimensions {
+		next := [][]*IndexField{}
+		for _, fields := range results {
+			if !dim.Required {
+				next = append(next, fields)
+			}
+			for _, fieldPath := range dim.Fields {
+				f := &IndexField{FieldPath: fieldPath}
+				if dim.Kind == ArrayContains {
+					f.ArrayConfig = ArrayConfigContains
+				} else {
+					f.Order = OrderAsc
+				}
+				next = append(next, appendField(fields, f))
+			}
+		}
+		results = next
+	}
+	return results
+}
+
+// appendField returns a new slice not to share the backing array
+func appendField(fields []*IndexField, f *IndexField) []*IndexField {
+	return append(append([]*IndexField{}, fields...), f)
+}
@@ -0,0 +1,213 @@
+// Package queryspec declares which filters and orderings can be queried,
+// shared by the web API and the index generator.
+package queryspec
+
+import (
+	"strconv"
+	"time"
+)
+
+// Field names
+const (
+	FieldID             = "ID"
+	FieldLabelName      = "LabelName"
+	FieldStatus         = "Status"
+	FieldSize0256       = "Size0256"
+	FieldSize0512       = "Size0512"
+	FieldSize1024       = "Size1024"
+	FieldUpdatedAt      = "UpdatedAt"
+	FieldPublishedAt    = "PublishedAt"
+	FieldCreatedAt      = "CreatedAt"
+	FieldConfidence     = "Confidence"
+	FieldMargin         = "Margin"
+	FieldTags           = "Tags"
+	FieldHasComments    = "HasComments"
+	FieldParts          = "Parts"
+	FieldCorrectedParts = "CorrectedParts"
+	FieldAngle          = "Meta.Angle"
+	FieldInterOcular    = "Geometry.InterOcular"
+	FieldFaceWidth      = "Geometry.FaceWidth"
+	FieldYaw            = "Geometry.Yaw"
+	FieldPitch          = "Geometry.Pitch"
+	FieldRoll           = "Geometry.Roll"
+	FieldSharpness      = "Quality.Sharpness"
+	FieldBrightness     = "Quality.Brightness"
+	FieldContrast       = "Quality.Contrast"
+	FieldJPEGQuality    = "Quality.JPEGQuality"
+)
+
+// Kind of filter
+type Kind int
+
+// Kind values
+const (
+	Equal Kind = iota
+	ArrayContains
+)
+
+// Dimension is a filter on one of Fields, which may be omitted unless Required
+type Dimension struct {
+	Fields   []string
+	Kind     Kind
+	Required bool
+}
+
+// Group is a combination of dimensions which can be ordered by each of Orders.
+// Range filters are supported only on the ordering field.
+type Group struct {
+	Dimensions []*Dimension
+	Orders     []string
+}
+
+// Spec type
+type Spec struct {
+	Collection string
+	// request parameter -> field
+	Sizes      map[string]string
+	Sorts      map[string]string
+	Ranges     map[string]string
+	DateRanges map[string]string
+	Groups     []*Group
+	// fields excluded from single-field indexes
+	Unindexed []string
+}
+
+var sizes = []string{FieldSize0256, FieldSize0512, FieldSize1024}
+
+// Image is the query spec of the Image collection
+var Image = &Spec{
+	Collection: "Image",
+	Sizes: map[string]string{
+		"256":  FieldSize0256,
+		"512":  FieldSize0512,
+		"1024": FieldSize1024,
+	},
+	Sorts: map[string]string{
+		"id":           FieldID,
+		"updated_at":   FieldUpdatedAt,
+		"published_at": FieldPublishedAt,
+		"created_at":   FieldCreatedAt,
+		"confidence":   FieldConfidence,
+		"uncertainty":  FieldMargin,
+		"angle":        FieldAngle,
+		"inter_ocular": FieldInterOcular,
+		"face_width":   FieldFaceWidth,
+		"yaw":          FieldYaw,
+		"pitch":        FieldPitch,
+		"roll":         FieldRoll,
+		"sharpness":    FieldSharpness,
+		"brightness":   FieldBrightness,
+		"contrast":     FieldContrast,
+		"jpeg_quality": FieldJPEGQuality,
+	},
+	Ranges: map[string]string{
+		"confidence":   FieldConfidence,
+		"angle":        FieldAngle,
+		"inter_ocular": FieldInterOcular,
+		"face_width":   FieldFaceWidth,
+		"yaw":          FieldYaw,
+		"pitch":        FieldPitch,
+		"roll":         FieldRoll,
+		"sharpness":    FieldSharpness,
+		"brightness":   FieldBrightness,
+		"contrast":     FieldContrast,
+		"jpeg_quality": FieldJPEGQuality,
+	},
+	DateRanges: map[string]string{
+		"published": FieldPublishedAt,
+		"updated":   FieldUpdatedAt,
+		"created":   FieldCreatedAt,
+	},
+	Groups: []*Group{
+		{
+			Dimensions: []*Dimension{
+				{Fields: []string{FieldLabelName}},
+				{Fields: []string{FieldStatus}},
+				{Fields: sizes},
+			},
+			Orders: []string{
+				FieldID, FieldUpdatedAt, FieldPublishedAt, FieldCreatedAt, FieldConfidence, FieldMargin, FieldAngle,
+				FieldInterOcular, FieldFaceWidth, FieldYaw, FieldPitch, FieldRoll,
+				FieldSharpness, FieldBrightness, FieldContrast, FieldJPEGQuality,
+			},
+		},
+		// `tag` filters (without `name` filter, other sorts are rejected to keep the index budget)
+		{
+			Dimensions: []*Dimension{
+				{Fields: []string{FieldTags}, Kind: ArrayContains, Required: true},
+				{Fields: []string{FieldStatus}},
+				{Fields: sizes},
+			},
+			Orders: []string{FieldID, FieldUpdatedAt, FieldPublishedAt},
+		},
+		// `has_comments` filters
+		{
+			Dimensions: []*Dimension{
+				{Fields: []string{FieldHasComments}, Required: true},
+				{Fields: []string{FieldStatus}},
+			},
+			Orders: []string{FieldID, FieldUpdatedAt},
+		},
+	},
+	Unindexed: []string{FieldParts, FieldCorrectedParts},
+}
+
+// Filter is a field and kind of a query filter
+type Filter struct {
+	Field string
+	Kind  Kind
+}
+
+// Covers reports whether the query with filters ordered by order field can be served.
+// Queries without filters or without ordering need only single-field indexes.
+func (s *Spec) Covers(filters []*Filter, order string) bool {
+	if len(filters) == 0 || order == "" {
+		return true
+	}
+	for _, group := range s.Groups {
+		if group.covers(filters, order) {
+			return true
+		}
+	}
+	return false
+}
+
+func (g *Group) covers(filters []*Filter, order string) bool {
+	if !contains(g.Orders, order) {
+		return false
+	}
+	matched := 0
+	for _, dim := range g.Dimensions {
+		n := 0
+		for _, filter := range filters {
+			if filter.Kind == dim.Kind && contains(dim.Fields, filter.Field) {
+				n++
+			}
+		}
+		if n > 1 || (n == 0 && dim.Required) {
+			return false
+		}
+		matched += n
+	}
+	return matched == len(filters)
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseTime parses unix time, RFC3339 or date (in UTC) of date range parameters
+func ParseTime(s string) (time.Time, error) {
+	if sec, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return time.Unix(sec, 0), nil
+	}
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	return time.Parse("2006-01-02", s)
+}
@@ -0,0 +1,229 @@
+package release
+
+import (
+	"encoding/csv"
+	"io"
+	"sort"
+
+	"github.com/sugyan/image-dataset/web/entity"
+)
+
+// Change kinds of images between releases, an image has the first kind which applies
+const (
+	ChangeAdded     = "added"
+	ChangeRemoved   = "removed"
+	ChangeRelabeled = "relabeled"
+	// status changed with the same label
+	ChangeStatus = "status"
+	// landmarks corrected with the same label and status
+	ChangeLandmarks = "landmarks"
+)
+
+// Change of an image between releases, nil From or To if added or removed
+type Change struct {
+	Kind string
+	From *entity.ReleaseItem
+	To   *entity.ReleaseItem
+}
+
+// ImageID returns the ID of the changed image
+func (c *Change) ImageID() string {
+	if c.From != nil {
+		return c.From.ImageID
+	}
+	return c.To.ImageID
+}
+
+// LabelSummary counts changes of a label
+type LabelSummary struct {
+	LabelName string
+	Added     int
+	Removed   int
+	// re-labeled from or to the label
+	RelabeledFrom int
+	RelabeledTo   int
+	// status or landmarks changed in the label
+	StatusChanged    int
+	LandmarksChanged int
+}
+
+// Transition counts images changed from a status to another.
+// Added and removed images have no status on the other side.
+type Transition struct {
+	From  *entity.Status
+	To    *entity.Status
+	Count int
+}
+
+// Diff between releases
+type Diff struct {
+	Changes     []*Change
+	Labels      []*LabelSummary
+	Transitions []*Transition
+}
+
+// Compare returns changes of items from a to b: images added, removed, re-labeled,
+// changed status or changed landmarks, in order of ImageID
+func Compare(a, b []*entity.ReleaseItem) *Diff {
+	from := map[string]*entity.ReleaseItem{}
+	for _, item := range a {
+		from[item.ImageID] = item
+	}
+	to := map[string]*entity.ReleaseItem{}
+	for _, item := range b {
+		to[item.ImageID] = item
+	}
+	changes := []*Change{}
+	for id, item := range from {
+		other, ok := to[id]
+		if !ok {
+			changes = append(changes, &Change{Kind: ChangeRemoved, From: item})
+			continue
+		}
+		switch {
+		case item.LabelName != other.LabelName:
+			changes = append(changes, &Change{Kind: ChangeRelabeled, From: item, To: other})
+		case item.Status != other.Status:
+			changes = append(changes, &Change{Kind: ChangeStatus, From: item, To: other})
+		case item.PartsCorrected != other.PartsCorrected || !equalLandmarks(item.Landmarks, other.Landmarks):
+			changes = append(changes, &Change{Kind: ChangeLandmarks, From: item, To: other})
+		}
+	}
+	for id, item := range to {
+		if _, ok := from[id]; !ok {
+			changes = append(changes, &Change{Kind: ChangeAdded, To: item})
+		}
+	}
+	sort.Slice(changes, func(i, j int) bool {
+		return changes[i].ImageID() < changes[j].ImageID()
+	})
+	return &Diff{
+		Changes:     changes,
+		Labels:      summarizeLabels(changes),
+		Transitions: summarizeTransitions(changes),
+	}
+}
+
+func summarizeLabels(changes []*Change) []*LabelSummary {
+	labels := map[string]*LabelSummary{}
+	label := func(name string) *LabelSummary {
+		if _, ok := labels[name]; !ok {
+			labels[name] = &LabelSummary{LabelName: name}
+		}
+		return labels[name]
+	}
+	for _, change := range changes {
+		switch change.Kind {
+		case ChangeAdded:
+			label(change.To.LabelName).Added++
+		case ChangeRemoved:
+			label(change.From.LabelName).Removed++
+		case ChangeRelabeled:
+			label(change.From.LabelName).RelabeledFrom++
+			label(change.To.LabelName).RelabeledTo++
+		case ChangeStatus:
+			label(change.To.LabelName).StatusChanged++
+		case ChangeLandmarks:
+			label(change.To.LabelName).LandmarksChanged++
+		}
+	}
+	results := []*LabelSummary{}
+	for _, summary := range labels {
+		results = append(results, summary)
+	}
+	sort.Slice(results, func(i, j int) bool {
+		return results[i].LabelName < results[j].LabelName
+	})
+	return results
+}
+
+func equalLandmarks(a, b []int) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func summarizeTransitions(changes []*Change) []*Transition {
+	type key struct {
+		from, to entity.Status
+	}
+	// -1 for no status of added or removed images
+	counts := map[key]int{}
+	for _, change := range changes {
+		k := key{-1, -1}
+		if change.From != nil {
+			k.from = change.From.Status
+		}
+		if change.To != nil {
+			k.to = change.To.Status
+		}
+		if k.from == k.to {
+			continue
+		}
+		counts[k]++
+	}
+	keys := []key{}
+	for k := range counts {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].from != keys[j].from {
+			return keys[i].from < keys[j].from
+		}
+		return keys[i].to < keys[j].to
+	})
+	results := []*Transition{}
+	for _, k := range keys {
+		transition := &Transition{Count: counts[k]}
+		if k.from >= 0 {
+			from := k.from
+			transition.From = &from
+		}
+		if k.to >= 0 {
+			to := k.to
+			transition.To = &to
+		}
+		results = append(results, transition)
+	}
+	return results
+}
+
+// WriteCSV writes changes of the diff as CSV with a header row
+func (d *Diff) WriteCSV(w io.Writer) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write([]string{"image_id", "change", "label_from", "label_to", "status_from", "status_to"}); err != nil {
+		return err
+	}
+	for _, change := range d.Changes {
+		row := []string{change.ImageID(), change.Kind, "", "", "", ""}
+		if change.From != nil {
+			row[2], row[4] = change.From.LabelName, change.From.Status.Path()
+		}
+		if change.To != nil {
+			row[3], row[5] = change.To.LabelName, change.To.Status.Path()
+		}
+		if err := cw.Write(row); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// String of the transition like `OK->NG`
+func (t *Transition) String() string {
+	from, to := "", ""
+	if t.From != nil {
+		from = t.From.Path()
+	}
+	if t.To != nil {
+		to = t.To.Path()
+	}
+	return from + "->" + to
+}
@@ -0,0 +1,131 @@
+package release
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+
+	"github.com/sugyan/image-dataset/web/entity"
+)
+
+func item(id, label string, status entity.Status, landmarks ...int) *entity.ReleaseItem {
+	return &entity.ReleaseItem{
+		ImageID:   id,
+		LabelName: label,
+		Status:    status,
+		Landmarks: landmarks,
+	}
+}
+
+func TestCompare(t *testing.T) {
+	testCases := []struct {
+		name        string
+		a, b        []*entity.ReleaseItem
+		kinds       map[string]string
+		labels      []LabelSummary
+		transitions []string
+	}{
+		{
+			name:        "same",
+			a:           []*entity.ReleaseItem{item("1", "foo", entity.StatusOK, 1, 2)},
+			b:           []*entity.ReleaseItem{item("1", "foo", entity.StatusOK, 1, 2)},
+			kinds:       map[string]string{},
+			labels:      []LabelSummary{},
+			transitions: []string{},
+		},
+		{
+			name:  "added and removed",
+			a:     []*entity.ReleaseItem{item("1", "foo", entity.StatusOK)},
+			b:     []*entity.ReleaseItem{item("2", "bar", entity.StatusNG)},
+			kinds: map[string]string{"1": ChangeRemoved, "2": ChangeAdded},
+			labels: []LabelSummary{
+				{LabelName: "bar", Added: 1},
+				{LabelName: "foo", Removed: 1},
+			},
+			transitions: []string{"->NG", "OK->"},
+		},
+		{
+			name:  "relabeled",
+			a:     []*entity.ReleaseItem{item("1", "foo", entity.StatusOK)},
+			b:     []*entity.ReleaseItem{item("1", "bar", entity.StatusNG)},
+			kinds: map[string]string{"1": ChangeRelabeled},
+			labels: []LabelSummary{
+				{LabelName: "bar", RelabeledTo: 1},
+				{LabelName: "foo", RelabeledFrom: 1},
+			},
+			transitions: []string{"OK->NG"},
+		},
+		{
+			name:  "status only",
+			a:     []*entity.ReleaseItem{item("1", "foo", entity.StatusReady), item("2", "foo", entity.StatusReady)},
+			b:     []*entity.ReleaseItem{item("1", "foo", entity.StatusOK), item("2", "foo", entity.StatusOK)},
+			kinds: map[string]string{"1": ChangeStatus, "2": ChangeStatus},
+			labels: []LabelSummary{
+				{LabelName: "foo", StatusChanged: 2},
+			},
+			transitions: []string{"Ready->OK"},
+		},
+		{
+			name:  "landmarks only",
+			a:     []*entity.ReleaseItem{item("1", "foo", entity.StatusOK, 1, 2)},
+			b:     []*entity.ReleaseItem{item("1", "foo", entity.StatusOK, 1, 3)},
+			kinds: map[string]string{"1": ChangeLandmarks},
+			labels: []LabelSummary{
+				{LabelName: "foo", LandmarksChanged: 1},
+			},
+			transitions: []string{},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			diff := Compare(tc.a, tc.b)
+			kinds := map[string]string{}
+			for _, change := range diff.Changes {
+				kinds[change.ImageID()] = change.Kind
+			}
+			if !reflect.DeepEqual(kinds, tc.kinds) {
+				t.Errorf("changes: got %v, want %v", kinds, tc.kinds)
+			}
+			labels := []LabelSummary{}
+			for _, label := range diff.Labels {
+				labels = append(labels, *label)
+			}
+			if !reflect.DeepEqual(labels, tc.labels) {
+				t.Errorf("labels: got %+v, want %+v", labels, tc.labels)
+			}
+			transitions := []string{}
+			for _, transition := range diff.Transitions {
+				transitions = append(transitions, transition.String())
+			}
+			if !reflect.DeepEqual(transitions, tc.transitions) {
+				t.Errorf("transitions: got %v, want %v", transitions, tc.transitions)
+			}
+		})
+	}
+}
+
+func TestWriteCSV(t *testing.T) {
+	a := []*entity.ReleaseItem{
+		item("1", "foo", entity.StatusOK),
+		item("2", "foo", entity.StatusReady),
+		item("3", "foo", entity.StatusOK),
+	}
+	b := []*entity.ReleaseItem{
+		item("2", "foo", entity.StatusNG),
+		item("3", "bar", entity.StatusOK),
+		item("4", "bar", entity.StatusPending),
+	}
+	var buf bytes.Buffer
+	if err := Compare(a, b).WriteCSV(&buf); err != nil {
+		t.Fatal(err)
+	}
+	expected := `image_id,change,label_from,label_to,status_from,status_to
+1,removed,foo,,OK,
+2,status,foo,foo,Ready,NG
+3,relabeled,foo,bar,OK,OK
+4,added,,bar,,Pending
+`
+	if buf.String() != expected {
+		t.Errorf("got:\n%s\nwant:\n%s", buf.String(), expected)
+	}
+}
@@ -0,0 +1,195 @@
+// Package release stores and loads named, immutable sets of images.
+package release
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"regexp"
+	"sort"
+
+	"cloud.google.com/go/firestore"
+	"github.com/sugyan/image-dataset/web/entity"
+	"google.golang.org/api/iterator"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// number of items per chunk document, within the size limit of a document
+const chunkSize = 500
+
+// number of chunks per batched write, within the size limit of a request
+const chunksPerBatch = 4
+
+var validName = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]{0,99}$`)
+
+// Errors
+var (
+	ErrInvalidName = errors.New("invalid release name")
+	ErrExists      = errors.New("release already exists")
+	ErrNotFound    = errors.New("release not found")
+)
+
+// ValidName reports whether name can be used as a release name
+func ValidName(name string) bool {
+	return validName.MatchString(name)
+}
+
+// NewItem returns the item of the image to be frozen in a release
+func NewItem(image *entity.Image) *entity.ReleaseItem {
+	return &entity.ReleaseItem{
+		ImageID:        image.ID,
+		ImageURL:       image.ImageURL,
+		Size:           image.Size,
+		Status:         image.Status,
+		LabelName:      image.LabelName,
+		Landmarks:      image.Landmarks(),
+		PartsCorrected: image.PartsCorrected,
+	}
+}
+
+// Checksum returns SHA-256 of the items in order of ImageID,
+// which identifies the content of a release regardless of its name
+func Checksum(items []*entity.ReleaseItem) (string, error) {
+	sorted := append([]*entity.ReleaseItem{}, items...)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].ImageID < sorted[j].ImageID
+	})
+	hash := sha256.New()
+	encoder := json.NewEncoder(hash)
+	for _, item := range sorted {
+		if err := encoder.Encode(item); err != nil {
+			return "", err
+		}
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// Create stores items as the release, which must not exist.
+// The name is reserved first, so concurrent requests of the same name do not mix their chunks.
+func Create(ctx context.Context, fsClient *firestore.Client, release *entity.Release, items []*entity.ReleaseItem) error {
+	if !ValidName(release.Name) {
+		return fmt.Errorf("%w: %s", ErrInvalidName, release.Name)
+	}
+	sort.Slice(items, func(i, j int) bool {
+		return items[i].ImageID < items[j].ImageID
+	})
+	checksum, err := Checksum(items)
+	if err != nil {
+		return err
+	}
+	release.Count = len(items)
+	release.Checksum = checksum
+	release.Chunks = (len(items) + chunkSize - 1) / chunkSize
+	release.Pending = true
+	docRef := fsClient.Collection(entity.KindNameRelease).Doc(release.Name)
+	if _, err := docRef.Create(ctx, release); err != nil {
+		if status.Code(err) == codes.AlreadyExists {
+			return fmt.Errorf("%w: %s", ErrExists, release.Name)
+		}
+		return err
+	}
+	if err := writeChunks(ctx, fsClient, docRef, items); err != nil {
+		// release the name, chunks are overwritten by the next attempt
+		if _, err := docRef.Delete(ctx); err != nil {
+			log.Printf("failed to delete pending release %s: %s", release.Name, err.Error())
+		}
+		return err
+	}
+	if _, err := docRef.Update(ctx, []firestore.Update{{Path: "Pending", Value: false}}); err != nil {
+		return err
+	}
+	release.Pending = false
+	return nil
+}
+
+func writeChunks(ctx context.Context, fsClient *firestore.Client, docRef *firestore.DocumentRef, items []*entity.ReleaseItem) error {
+	chunks := 0
+	for i := 0; i < len(items); i += chunkSize * chunksPerBatch {
+		batch := fsClient.Batch()
+		for j := i; j < len(items) && j < i+chunkSize*chunksPerBatch; j += chunkSize {
+			end := j + chunkSize
+			if end > len(items) {
+				end = len(items)
+			}
+			batch.Set(docRef.Collection(entity.KindNameReleaseChunk).Doc(chunkID(chunks)), &entity.ReleaseChunk{
+				Items: items[j:end],
+			})
+			chunks++
+		}
+		if _, err := batch.Commit(ctx); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Get returns the release and its items in order of ImageID
+func Get(ctx context.Context, fsClient *firestore.Client, name string) (*entity.Release, []*entity.ReleaseItem, error) {
+	docRef := fsClient.Collection(entity.KindNameRelease).Doc(name)
+	document, err := docRef.Get(ctx)
+	if err != nil {
+		if status.Code(err) == codes.NotFound {
+			return nil, nil, fmt.Errorf("%w: %s", ErrNotFound, name)
+		}
+		return nil, nil, err
+	}
+	var release entity.Release
+	if err := document.DataTo(&release); err != nil {
+		return nil, nil, err
+	}
+	if release.Pending {
+		return nil, nil, fmt.Errorf("%w: %s is being created", ErrNotFound, name)
+	}
+	items := []*entity.ReleaseItem{}
+	for i := 0; i < release.Chunks; i++ {
+		document, err := docRef.Collection(entity.KindNameReleaseChunk).Doc(chunkID(i)).Get(ctx)
+		if err != nil {
+			return nil, nil, err
+		}
+		var chunk entity.ReleaseChunk
+		if err := document.DataTo(&chunk); err != nil {
+			return nil, nil, err
+		}
+		items = append(items, chunk.Items...)
+	}
+	if len(items) != release.Count {
+		return nil, nil, fmt.Errorf("release %s has %d items, expected %d", name, len(items), release.Count)
+	}
+	return &release, items, nil
+}
+
+// List returns all created releases in order of creation, newest first
+func List(ctx context.Context, fsClient *firestore.Client) ([]*entity.Release, error) {
+	releases := []*entity.Release{}
+	iter := fsClient.Collection(entity.KindNameRelease).
+		OrderBy("CreatedAt", firestore.Desc).
+		Documents(ctx)
+	for {
+		document, err := iter.Next()
+		if err != nil {
+			if errors.Is(err, iterator.Done) {
+				break
+			} else {
+				return nil, err
+			}
+		}
+		var release entity.Release
+		if err := document.DataTo(&release); err != nil {
+			return nil, err
+		}
+		if release.Pending {
+			continue
+		}
+		releases = append(releases, &release)
+	}
+	return releases, nil
+}
+
+func chunkID(i int) string {
+	return fmt.Sprintf("%05d", i)
+}